@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"gioui.org/app"
+)
+
+// DetectResult is the outcome of probing one candidate configuration
+type DetectResult struct {
+	Settings SerialSettings
+	Lines    int // complete lines or frames received
+	Parsed   int // lines or frames accepted by the protocol
+}
+
+// DetectEvent reports auto-detection progress to the UI; Done is set on
+// the final event, which carries either Result or Err
+type DetectEvent struct {
+	Message string
+	Done    bool
+	Result  DetectResult
+	Err     error
+}
+
+var (
+	detectBaudRates = []int{115200, 921600, 460800, 230400, 57600, 38400, 19200, 9600}
+	detectParities  = []string{"none", "odd", "even"}
+)
+
+const (
+	detectWindow     = 1500 * time.Millisecond
+	detectGoodEnough = 5 // parsed lines without any failure that end the search early
+)
+
+// score ranks candidates: parsed packets count most, garbage lines count
+// against the candidate
+func (r DetectResult) score() int {
+	return r.Parsed*2 - (r.Lines - r.Parsed)
+}
+
+// startDetect probes the port in the background and reports progress and
+// the final result on events
+func startDetect(w *app.Window, name string, base SerialSettings, events chan<- DetectEvent) {
+	go func() {
+		send := func(ev DetectEvent) {
+			events <- ev
+			w.Invalidate()
+		}
+		best, err := DetectSettings(name, base, func(msg string) {
+			send(DetectEvent{Message: msg})
+		})
+		send(DetectEvent{Done: true, Result: best, Err: err})
+	}()
+}
+
+// DetectSettings tries candidate baud rates and parities on the named port,
+// scoring each by how many lines ParsePacket accepts within a short window,
+// and returns the best one; data bits, stop bits and timeout come from base
+func DetectSettings(name string, base SerialSettings, progress func(string)) (DetectResult, error) {
+	if name == "" {
+		return DetectResult{}, errors.New("no port selected")
+	}
+
+	var best DetectResult
+	found := false
+
+	for _, baud := range detectBaudRates {
+		for _, parity := range detectParities {
+			cfg := base
+			cfg.Baud = baud
+			cfg.Parity = parity
+			if err := cfg.Validate(); err != nil {
+				continue
+			}
+
+			r, err := probe(name, cfg)
+			if err != nil {
+				return best, err
+			}
+			progress(fmt.Sprintf("[DETECT] %s: %d/%d lines parsed", cfg, r.Parsed, r.Lines))
+
+			if r.Parsed > 0 && (!found || r.score() > best.score()) {
+				best = r
+				found = true
+			}
+			if r.Parsed >= detectGoodEnough && r.Parsed == r.Lines {
+				return best, nil
+			}
+		}
+	}
+
+	if !found {
+		return best, errors.New("no configuration produced valid packets")
+	}
+	return best, nil
+}
+
+// probe opens the port with one configuration and counts the lines or
+// binary frames received and parsed during detectWindow
+func probe(name string, cfg SerialSettings) (DetectResult, error) {
+	r := DetectResult{Settings: cfg}
+
+	// Short timeout so the window is respected even on a silent line
+	probeCfg := cfg
+	probeCfg.ReadTimeoutMs = 100
+
+	port, err := openSerial(name, probeCfg)
+	if err != nil {
+		return r, err
+	}
+	defer port.Close()
+
+	var pending []byte
+	buf := make([]byte, 512)
+	deadline := time.Now().Add(detectWindow)
+	first := true
+
+	for time.Now().Before(deadline) {
+		n, _ := port.Read(buf)
+		pending = append(pending, buf[:n]...)
+
+		if scan := frameScanner(cfg.WireProtocol()); scan != nil {
+			var frames, valid int
+			frames, valid, pending = scan(pending)
+			r.Lines += frames
+			r.Parsed += valid
+			continue
+		}
+
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := string(pending[:i])
+			pending = pending[i+1:]
+
+			// The first line is usually cut off mid-packet
+			if first {
+				first = false
+				continue
+			}
+			r.Lines++
+			if acceptsLine(cfg.WireProtocol(), line) {
+				r.Parsed++
+			}
+		}
+
+		// Wrong baud rates rarely produce newlines; don't let the
+		// buffer grow without bound
+		if len(pending) > 4096 {
+			r.Lines++
+			pending = pending[:0]
+		}
+	}
+
+	return r, nil
+}
+
+// frameScanner returns the frame counter of a binary protocol, or nil for
+// line based ones
+func frameScanner(proto Protocol) func([]byte) (frames, valid int, rest []byte) {
+	switch proto {
+	case ProtocolUBX:
+		return scanUBX
+	case ProtocolBinary:
+		return scanBinaryFrames
+	default:
+		return nil
+	}
+}
+
+// acceptsLine reports whether a line is valid in the given protocol; for
+// NMEA any well-formed sentence counts, whether or not it ends a packet
+func acceptsLine(proto Protocol, line string) bool {
+	if proto == ProtocolNMEA {
+		_, _, err := parseNMEA(line)
+		return err == nil
+	}
+	_, err := ParsePacket(line)
+	return err == nil
+}
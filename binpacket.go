@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Binary telemetry packets are COBS encoded and terminated by a zero byte.
+// Decoded, version 1 is laid out little-endian as:
+//
+//	 0  u8      version (1)
+//	 1  u8      device ID length n (at most 32), followed by n ID bytes
+//	+0  u32     sequence number
+//	+4  u32     device time, milliseconds since midnight
+//	+8  i32     latitude, 1e-7 degrees
+//	+12 i32     longitude, 1e-7 degrees
+//	+16 u8      satellites
+//	+17 u8      fix: 0 none, 1 2D, 2 3D
+//	+18 u8      GNSS flags: altitude, speed, course, HDOP, PDOP, fix
+//	+19 u8      IMU flags: gyroscope, magnetometer, temperature
+//	+20 i32     altitude, mm
+//	+24 u16     speed, 0.01 km/h
+//	+26 u16     course, 0.01 degrees
+//	+28 u16     HDOP, 0.01
+//	+30 u16     PDOP, 0.01
+//	+32 3×i16   acceleration, mg
+//	+38 3×i16   gyroscope, 0.1 °/s
+//	+44 3×i16   magnetometer, 0.1 µT
+//	+50 i16     temperature, 0.01 °C
+//	+52 u16     CRC-16/CCITT-FALSE of every byte before it
+//
+// Fields whose flag is clear are sent as zero.
+const (
+	binVersion     = 1
+	binMaxIDLen    = 32
+	binBodyLen     = 52
+	binMaxFrameLen = 2 + binMaxIDLen + binBodyLen + 2 + 2 // with COBS overhead and delimiter
+)
+
+// Wire values of the flag bytes; they are part of the format and must not
+// follow changes to GNSSFields or IMUFields
+var (
+	binGNSSFlags = []GNSSFields{HasAltitude, HasSpeed, HasCourse, HasHDOP, HasPDOP, HasFix}
+	binIMUFlags  = []IMUFields{HasGyro, HasMagnetometer, HasTemperature}
+)
+
+var (
+	errBinVersion = errors.New("unsupported binary packet version")
+	errCOBS       = errors.New("invalid COBS encoding")
+)
+
+// cobsEncode appends the COBS encoding of data to dst, without the zero
+// delimiter
+func cobsEncode(dst, data []byte) []byte {
+	code := len(dst)
+	dst = append(dst, 0)
+	n := byte(1)
+	for _, c := range data {
+		if c != 0 {
+			dst = append(dst, c)
+			n++
+		}
+		if c == 0 || n == 0xFF {
+			dst[code] = n
+			code = len(dst)
+			dst = append(dst, 0)
+			n = 1
+		}
+	}
+	dst[code] = n
+	return dst
+}
+
+// cobsDecode reverses cobsEncode; frame must not include the delimiter
+func cobsDecode(frame []byte) ([]byte, error) {
+	out := make([]byte, 0, len(frame))
+	for i := 0; i < len(frame); {
+		n := int(frame[i])
+		if n == 0 || i+n > len(frame) {
+			return nil, errCOBS
+		}
+		out = append(out, frame[i+1:i+n]...)
+		i += n
+		if n < 0xFF && i < len(frame) {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
+
+// EncodeBinaryPacket serializes a packet in the binary telemetry format,
+// COBS framed and ready to send
+func EncodeBinaryPacket(p Packet) ([]byte, error) {
+	if len(p.DeviceID) > binMaxIDLen {
+		return nil, fmt.Errorf("device ID %q longer than %d bytes", p.DeviceID, binMaxIDLen)
+	}
+
+	b := make([]byte, 2+len(p.DeviceID)+binBodyLen, 2+len(p.DeviceID)+binBodyLen+2)
+	b[0] = binVersion
+	b[1] = byte(len(p.DeviceID))
+	copy(b[2:], p.DeviceID)
+
+	var err error
+	fixed := func(name string, v, scale, lo, hi float64) int64 {
+		x := math.Round(v * scale)
+		if err == nil && (math.IsNaN(x) || x < lo || x > hi) {
+			err = fmt.Errorf("%s %g does not fit the binary format", name, v)
+		}
+		return int64(x)
+	}
+	i16 := func(name string, v, scale float64) uint16 {
+		return uint16(int16(fixed(name, v, scale, math.MinInt16, math.MaxInt16)))
+	}
+	u16 := func(name string, v, scale float64) uint16 {
+		return uint16(fixed(name, v, scale, 0, math.MaxUint16))
+	}
+
+	le := binary.LittleEndian
+	d := b[2+len(p.DeviceID):]
+	le.PutUint32(d[0:], p.Seq)
+	le.PutUint32(d[4:], binTimeOfDay(p))
+	le.PutUint32(d[8:], uint32(int32(fixed("Latitude", p.Latitude, 1e7, -90e7, 90e7))))
+	le.PutUint32(d[12:], uint32(int32(fixed("Longitude", p.Longitude, 1e7, -180e7, 180e7))))
+	d[16] = byte(min(max(p.Satellites, 0), math.MaxUint8))
+	d[17] = byte(p.Fix)
+	for bit, f := range binGNSSFlags {
+		if p.GNSS.Has(f) {
+			d[18] |= 1 << bit
+		}
+	}
+	for bit, f := range binIMUFlags {
+		if p.IMU.Has(f) {
+			d[19] |= 1 << bit
+		}
+	}
+	if p.GNSS.Has(HasAltitude) {
+		le.PutUint32(d[20:], uint32(int32(fixed("Altitude", p.Altitude, 1000, math.MinInt32, math.MaxInt32))))
+	}
+	if p.GNSS.Has(HasSpeed) {
+		le.PutUint16(d[24:], u16("Speed", p.Speed, 100))
+	}
+	if p.GNSS.Has(HasCourse) {
+		le.PutUint16(d[26:], u16("Course", p.Course, 100))
+	}
+	if p.GNSS.Has(HasHDOP) {
+		le.PutUint16(d[28:], u16("HDOP", p.HDOP, 100))
+	}
+	if p.GNSS.Has(HasPDOP) {
+		le.PutUint16(d[30:], u16("PDOP", p.PDOP, 100))
+	}
+	for axis := 0; axis < 3; axis++ {
+		le.PutUint16(d[32+2*axis:], i16("Acceleration", p.Acceleration[axis], 1000))
+		if p.IMU.Has(HasGyro) {
+			le.PutUint16(d[38+2*axis:], i16("Gyro", p.Gyro[axis], 10))
+		}
+		if p.IMU.Has(HasMagnetometer) {
+			le.PutUint16(d[44+2*axis:], i16("Magnetometer", p.Magnetometer[axis], 10))
+		}
+	}
+	if p.IMU.Has(HasTemperature) {
+		le.PutUint16(d[50:], i16("Temperature", p.Temperature, 100))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b = le.AppendUint16(b, checksumCRC16(b))
+	return append(cobsEncode(make([]byte, 0, binMaxFrameLen), b), 0), nil
+}
+
+// binTimeOfDay returns the packet's device time as milliseconds since
+// midnight on the device clock, taken from DeviceTime or else the Time
+// string
+func binTimeOfDay(p Packet) uint32 {
+	t := p.DeviceTime.In(deviceLocation)
+	if p.DeviceTime.IsZero() {
+		var err error
+		if t, err = time.Parse("15:04:05", p.Time); err != nil {
+			return 0
+		}
+	}
+	// From the wall clock; elapsed time since midnight is off on DST days
+	h, m, s := t.Clock()
+	return uint32(((h*60+m)*60+s)*1000 + t.Nanosecond()/int(time.Millisecond))
+}
+
+// DecodeBinaryPacket parses one COBS frame without its zero delimiter
+func DecodeBinaryPacket(frame []byte) (Packet, error) {
+	var p Packet
+	line := string(frame)
+
+	b, err := cobsDecode(frame)
+	if err != nil {
+		return p, &ParseError{Kind: ParseFormat, Line: line, Err: err}
+	}
+	if len(b) < 2 {
+		return p, &ParseError{Kind: ParseTruncated, Line: line, Offset: len(frame), Err: fmt.Errorf("%d byte frame", len(b))}
+	}
+	if b[0] != binVersion {
+		return p, &ParseError{Kind: ParseFormat, Field: "version", Value: fmt.Sprint(b[0]), Offset: 0, Line: line, Err: errBinVersion}
+	}
+	idLen := int(b[1])
+	if want := 2 + idLen + binBodyLen + 2; idLen > binMaxIDLen || len(b) != want {
+		return p, &ParseError{Kind: ParseTruncated, Line: line, Offset: len(frame),
+			Err: fmt.Errorf("%d of %d bytes", len(b), want)}
+	}
+
+	end := len(b) - 2
+	le := binary.LittleEndian
+	if got, want := checksumCRC16(b[:end]), le.Uint16(b[end:]); got != want {
+		return p, &ParseError{Kind: ParseChecksum, Field: "Checksum", Value: fmt.Sprintf("%04X", want), Offset: len(frame) - 2,
+			Line: line, Err: fmt.Errorf("%w: got %04X", ErrChecksum, got)}
+	}
+	p.Checksum = ChecksumCRC16
+
+	p.DeviceID = string(b[2 : 2+idLen])
+	d := b[2+idLen : end]
+	i16 := func(at int, scale float64) float64 { return float64(int16(le.Uint16(d[at:]))) / scale }
+	u16 := func(at int, scale float64) float64 { return float64(le.Uint16(d[at:])) / scale }
+
+	p.Seq = le.Uint32(d[0:])
+	p.HasSeq = true
+	p.Time = time.Time{}.Add(time.Duration(le.Uint32(d[4:])) * time.Millisecond).Format("15:04:05.000")
+	p.Latitude = float64(int32(le.Uint32(d[8:]))) * 1e-7
+	p.Longitude = float64(int32(le.Uint32(d[12:]))) * 1e-7
+	p.Satellites = int(d[16])
+	if d[17] > byte(Fix3D) {
+		return p, &ParseError{Kind: ParseOutOfRange, Field: "Fix", Value: fmt.Sprint(d[17]), Line: line, Offset: -1}
+	}
+	p.Fix = FixType(d[17])
+	for bit, f := range binGNSSFlags {
+		if d[18]&(1<<bit) != 0 {
+			p.GNSS |= f
+		}
+	}
+	for bit, f := range binIMUFlags {
+		if d[19]&(1<<bit) != 0 {
+			p.IMU |= f
+		}
+	}
+	p.Altitude = float64(int32(le.Uint32(d[20:]))) / 1000
+	p.Speed = u16(24, 100)
+	p.Course = u16(26, 100)
+	p.HDOP = u16(28, 100)
+	p.PDOP = u16(30, 100)
+	for axis := 0; axis < 3; axis++ {
+		p.Acceleration[axis] = i16(32+2*axis, 1000)
+		p.Gyro[axis] = i16(38+2*axis, 10)
+		p.Magnetometer[axis] = i16(44+2*axis, 10)
+	}
+	p.Temperature = i16(50, 100)
+	return p, nil
+}
+
+// binaryDecoder splits a byte stream into zero delimited COBS frames
+type binaryDecoder struct {
+	reader *bufio.Reader
+}
+
+func (d *binaryDecoder) Next() (SourceEvent, error) {
+	for {
+		frame, err := d.reader.ReadSlice(0)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// No delimiter in a whole buffer: noise or a wrong baud rate
+			raw := string(frame)
+			return SourceEvent{Raw: raw, Time: time.Now(), Binary: true,
+				Err: &ParseError{Kind: ParseFormat, Line: raw, Err: errCOBS}}, nil
+		}
+		if err != nil && (err != io.EOF || len(frame) == 0) {
+			return SourceEvent{}, err
+		}
+		if len(frame) == 1 {
+			continue // back-to-back delimiters
+		}
+
+		ev := SourceEvent{Raw: string(frame), Time: time.Now(), Binary: true}
+		if err == nil {
+			frame = frame[:len(frame)-1]
+		}
+		ev.Packet, ev.Err = DecodeBinaryPacket(frame)
+		ev.Response = ev.Err != nil && isTextReply(ev.Raw)
+		return ev, nil
+	}
+}
+
+// scanBinaryFrames counts the zero delimited frames in a capture and how
+// many of them decode, returning the incomplete tail; used by
+// auto-detection
+func scanBinaryFrames(data []byte) (frames, valid int, rest []byte) {
+	for {
+		i := 0
+		for i < len(data) && data[i] != 0 {
+			i++
+		}
+		if i == len(data) {
+			if len(data) > binMaxFrameLen {
+				return frames + 1, valid, nil
+			}
+			return frames, valid, data
+		}
+		if i > 0 {
+			frames++
+			if _, err := DecodeBinaryPacket(data[:i]); err == nil {
+				valid++
+			}
+		}
+		data = data[i+1:]
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "time"
+
+// GraphChannel is one plottable value of a packet
+type GraphChannel struct {
+	Name   string // label in the channel picker
+	Field  string // schema field, for the unit
+	Column string // packets table column
+	value  func(p Packet) (float64, bool)
+}
+
+// Unit returns the channel's unit as declared in the field schema
+func (c GraphChannel) Unit() string {
+	return fieldSchema.Unit(c.Field)
+}
+
+// Value extracts the channel from a packet; ok is false when the packet
+// did not carry it
+func (c GraphChannel) Value(p Packet) (float64, bool) {
+	return c.value(p)
+}
+
+func axisChannel(name, field, column string, axis int) GraphChannel {
+	return GraphChannel{
+		Name:   name,
+		Field:  field,
+		Column: column,
+		value: func(p Packet) (float64, bool) {
+			switch field {
+			case "Gyro":
+				return p.Gyro[axis], p.IMU.Has(HasGyro)
+			case "Magnetometer":
+				return p.Magnetometer[axis], p.IMU.Has(HasMagnetometer)
+			default:
+				return p.Acceleration[axis], true
+			}
+		},
+	}
+}
+
+// graphChannels lists the channels offered in the graph, the first one
+// being the default
+var graphChannels = []GraphChannel{
+	axisChannel("AccZ", "Acceleration", "acceleration_z", 2),
+	axisChannel("AccX", "Acceleration", "acceleration_x", 0),
+	axisChannel("AccY", "Acceleration", "acceleration_y", 1),
+	axisChannel("GyroX", "Gyro", "gyro_x", 0),
+	axisChannel("GyroY", "Gyro", "gyro_y", 1),
+	axisChannel("GyroZ", "Gyro", "gyro_z", 2),
+	axisChannel("MagX", "Magnetometer", "mag_x", 0),
+	axisChannel("MagY", "Magnetometer", "mag_y", 1),
+	axisChannel("MagZ", "Magnetometer", "mag_z", 2),
+	{
+		Name:   "Temp",
+		Field:  "Temperature",
+		Column: "temperature",
+		value: func(p Packet) (float64, bool) {
+			return p.Temperature, p.IMU.Has(HasTemperature)
+		},
+	},
+}
+
+// graphChannelNames returns the picker labels of graphChannels
+func graphChannelNames() []string {
+	names := make([]string, len(graphChannels))
+	for i, c := range graphChannels {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// findGraphChannel looks a channel up by its picker label, falling back to
+// the default channel
+func findGraphChannel(name string) GraphChannel {
+	for _, c := range graphChannels {
+		if c.Name == name {
+			return c
+		}
+	}
+	return graphChannels[0]
+}
+
+// channelSeries extracts a channel from recent packets, skipping packets
+// that did not carry it
+func channelSeries(packets []Packet, c GraphChannel) ([]float32, []time.Time) {
+	series := make([]float32, 0, len(packets))
+	times := make([]time.Time, 0, len(packets))
+	for _, p := range packets {
+		if v, ok := c.Value(p); ok {
+			series = append(series, float32(v))
+			times = append(times, p.ReceivedAt)
+		}
+	}
+	return series, times
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChecksumStatus records which checksum, if any, protected a packet
+type ChecksumStatus string
+
+const (
+	ChecksumNone  ChecksumStatus = "none"
+	ChecksumXOR   ChecksumStatus = "xor"
+	ChecksumCRC16 ChecksumStatus = "crc16"
+)
+
+// ErrChecksum is returned for lines whose checksum trailer does not match
+var ErrChecksum = errors.New("checksum mismatch")
+
+var errMalformedTrailer = errors.New("checksum trailer must be 2 or 4 hex digits")
+
+// splitChecksum verifies an optional "*HH" (XOR) or "*HHHH" (CRC-16)
+// trailer and returns the line without it; the checksum covers every byte
+// before the '*', excluding a leading '$' as in NMEA
+func splitChecksum(line string) (string, ChecksumStatus, error) {
+	idx := strings.LastIndexByte(line, '*')
+	if idx < 0 {
+		return line, ChecksumNone, nil
+	}
+
+	body, trailer := line[:idx], line[idx+1:]
+	fail := func(kind ParseErrorKind, err error) error {
+		return &ParseError{Kind: kind, Field: "Checksum", Value: trailer, Offset: idx + 1, Line: line, Err: err}
+	}
+	want, err := strconv.ParseUint(trailer, 16, 16)
+	if err != nil {
+		return line, ChecksumNone, fail(ParseBadNumber, errMalformedTrailer)
+	}
+
+	data := strings.TrimPrefix(body, "$")
+	switch len(trailer) {
+	case 2:
+		if got := checksumXOR(data); uint64(got) != want {
+			return line, ChecksumXOR, fail(ParseChecksum, fmt.Errorf("%w: got %02X", ErrChecksum, got))
+		}
+		return body, ChecksumXOR, nil
+	case 4:
+		if got := checksumCRC16(data); uint64(got) != want {
+			return line, ChecksumCRC16, fail(ParseChecksum, fmt.Errorf("%w: got %04X", ErrChecksum, got))
+		}
+		return body, ChecksumCRC16, nil
+	default:
+		return line, ChecksumNone, fail(ParseBadNumber, errMalformedTrailer)
+	}
+}
+
+// AppendChecksum adds a checksum trailer of the given kind to a line
+func AppendChecksum(line string, kind ChecksumStatus) string {
+	data := strings.TrimPrefix(line, "$")
+	switch kind {
+	case ChecksumXOR:
+		return fmt.Sprintf("%s*%02X", line, checksumXOR(data))
+	case ChecksumCRC16:
+		return fmt.Sprintf("%s*%04X", line, checksumCRC16(data))
+	default:
+		return line
+	}
+}
+
+// checksumXOR is the NMEA 0183 checksum: all bytes XORed together
+func checksumXOR[T string | []byte](data T) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum ^= data[i]
+	}
+	return sum
+}
+
+// checksumCRC16 computes CRC-16/CCITT-FALSE (poly 0x1021, init 0xFFFF)
+func checksumCRC16[T string | []byte](data T) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
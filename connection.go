@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gioui.org/app"
+)
+
+// ConnState describes the state of the active source
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnected
+	StateReconnecting
+)
+
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// errDeviceLost is returned by the reader when the device disappears
+var errDeviceLost = errors.New("device lost")
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "Connected"
+	case StateReconnecting:
+		return "Reconnecting"
+	default:
+		return "Disconnected"
+	}
+}
+
+// ConnEvent reports a connection state change to the UI
+type ConnEvent struct {
+	State   ConnState
+	Source  string
+	Message string
+}
+
+// SourceManager owns the active packet source and the goroutine reading
+// from it, reopening persistent sources when they fail
+type SourceManager struct {
+	mu sync.Mutex
+
+	window *app.Window
+	out    chan SourceEvent
+	events chan ConnEvent
+	writer *DBWriter
+	rec    *Recorder
+
+	source PacketSource
+	stop   chan struct{}
+	done   chan struct{}
+
+	// showRaw is set while the raw monitor is on screen
+	showRaw atomic.Bool
+
+	// The live stream changes on reconnect and is guarded separately so
+	// that Send never waits for a Close in progress
+	streamMu sync.Mutex
+	stream   io.ReadCloser
+}
+
+// NewSourceManager creates a manager that delivers received lines to out
+// and connection state changes to events, passing every line to rec and
+// valid packets to writer, which may be nil
+func NewSourceManager(w *app.Window, out chan SourceEvent, events chan ConnEvent, writer *DBWriter, rec *Recorder) *SourceManager {
+	return &SourceManager{
+		window: w,
+		out:    out,
+		events: events,
+		writer: writer,
+		rec:    rec,
+	}
+}
+
+// Open opens the named serial port with the given settings
+func (m *SourceManager) Open(name string, settings SerialSettings) error {
+	src, err := NewSerialSource(name, settings)
+	if err != nil {
+		return err
+	}
+	return m.Start(src)
+}
+
+// Start opens the source and starts reading from it; any previously
+// active source is closed first
+func (m *SourceManager) Start(src PacketSource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeLocked()
+
+	stream, err := src.Open()
+	if err != nil {
+		return err
+	}
+
+	m.source = src
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go m.run(src, stream, m.stop, m.done)
+	return nil
+}
+
+// Close stops the reader goroutine and closes the source
+func (m *SourceManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeLocked()
+	return nil
+}
+
+// Reopen closes and opens the last used source again
+func (m *SourceManager) Reopen() error {
+	m.mu.Lock()
+	src := m.source
+	m.mu.Unlock()
+
+	if src == nil {
+		return errors.New("no source was opened before")
+	}
+	return m.Start(src)
+}
+
+// IsOpen reports whether a source is open or being reconnected
+func (m *SourceManager) IsOpen() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stop != nil
+}
+
+// Send writes data to the active source if it accepts commands
+func (m *SourceManager) Send(data []byte) error {
+	m.streamMu.Lock()
+	defer m.streamMu.Unlock()
+
+	if m.stream == nil {
+		return errors.New("no source is connected")
+	}
+	w, ok := m.stream.(io.Writer)
+	if !ok {
+		return errors.New("source does not accept commands")
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
+}
+
+// Protocol returns the wire protocol of the last opened source
+func (m *SourceManager) Protocol() Protocol {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.source == nil {
+		return ProtocolText
+	}
+	return protocolOf(m.source)
+}
+
+// ShowRaw tells the manager whether the raw monitor is on screen; valid
+// lines only carry their raw text while it is
+func (m *SourceManager) ShowRaw(show bool) {
+	m.showRaw.Store(show)
+}
+
+// setStream publishes the stream that Send writes to
+func (m *SourceManager) setStream(stream io.ReadCloser) {
+	m.streamMu.Lock()
+	m.stream = stream
+	m.streamMu.Unlock()
+}
+
+// closeLocked stops the reader goroutine and waits for it to release the
+// source; m.mu must be held
+func (m *SourceManager) closeLocked() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+	m.done = nil
+}
+
+// run reads from the stream and, when a persistent source fails, keeps
+// trying to reopen it with exponential backoff until stop is closed
+func (m *SourceManager) run(src PacketSource, stream io.ReadCloser, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	name := src.Name()
+	m.notify(StateConnected, name, "")
+
+	// A replayed session was stored when it was recorded
+	replay := isReplay(src)
+
+	for {
+		err := m.read(stream, protocolOf(src), !replay, stop)
+		if err == nil {
+			m.notify(StateDisconnected, name, "")
+			return
+		}
+		if !src.Persistent() {
+			msg := "[SOURCE] " + name + " finished"
+			if err != io.EOF {
+				msg = fmt.Sprintf("[SOURCE] %s: %v", name, err)
+			}
+			m.notify(StateDisconnected, name, msg)
+			return
+		}
+
+		m.notify(StateReconnecting, name, fmt.Sprintf("[SOURCE] %s: %v", name, err))
+
+		delay := reconnectMinDelay
+		for stream = nil; stream == nil; {
+			select {
+			case <-stop:
+				m.notify(StateDisconnected, name, "")
+				return
+			case <-time.After(delay):
+			}
+
+			if stream, err = src.Open(); err == nil {
+				break
+			}
+			stream = nil
+			log.Println("reconnect failed:", err)
+
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+			m.notify(StateReconnecting, name, fmt.Sprintf("[SOURCE] Waiting for %s, next attempt in %s", name, delay))
+		}
+
+		m.notify(StateConnected, name, "[SOURCE] Reconnected: "+name)
+	}
+}
+
+// read pumps the stream until stop is closed (returning nil) or the stream
+// fails (returning the cause); the stream is closed on return. Packets are
+// queued for the database if save is set
+func (m *SourceManager) read(stream io.ReadCloser, proto Protocol, save bool, stop <-chan struct{}) error {
+	finished := make(chan struct{})
+	defer close(finished)
+
+	m.setStream(stream)
+	defer m.setStream(nil)
+
+	// Closing the stream unblocks a pending read when we are stopped
+	go func() {
+		select {
+		case <-stop:
+		case <-finished:
+		}
+		stream.Close()
+	}()
+
+	// Raw lines are only copied for the monitor and the recorder
+	keepRaw := func() bool { return m.showRaw.Load() || m.rec.Active() }
+	err := readSource(stream, proto, keepRaw, func(ev SourceEvent) {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		m.deliver(ev, save)
+	})
+
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// deliver records a line, hands it to the UI, dropping the oldest one if
+// the UI falls behind, and queues valid packets for the database if save
+// is set
+func (m *SourceManager) deliver(ev SourceEvent, save bool) {
+	if err := m.rec.Record(ev); err != nil {
+		log.Println(err)
+	}
+
+	select {
+	case m.out <- ev:
+	default:
+		select {
+		case <-m.out:
+		default:
+		}
+		m.out <- ev
+	}
+
+	// Auto-save to database if connected
+	if save && m.writer != nil && ev.Err == nil && !ev.Fragment {
+		m.writer.Enqueue(ev.Packet)
+	}
+
+	m.window.Invalidate()
+}
+
+// notify publishes a state change without blocking the reader
+func (m *SourceManager) notify(state ConnState, source, msg string) {
+	select {
+	case m.events <- ConnEvent{State: state, Source: source, Message: msg}:
+	default:
+		log.Println("connection event dropped:", msg)
+	}
+	m.window.Invalidate()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gioui.org/app"
+)
+
+// writeSession records the frames of packets encoded in proto to a
+// session file
+func writeSession(t *testing.T, proto Protocol, packets []Packet) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.log")
+	rec := &Recorder{}
+	if err := rec.Start(path, proto); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	for _, p := range packets {
+		data, err := EncodePacket(proto, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary := proto == ProtocolBinary || proto == ProtocolUBX
+		frames := [][]byte{data}
+		if !binary {
+			frames = frames[:0]
+			for line := range bytes.Lines(data) {
+				frames = append(frames, bytes.TrimRight(line, "\r\n"))
+			}
+		}
+		for _, frame := range frames {
+			ev := SourceEvent{Raw: string(frame), Time: stamp, Binary: binary}
+			if err := rec.Record(ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stamp = stamp.Add(time.Millisecond)
+	}
+	if _, err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// dropSessionHeader turns a session into one recorded before sessions had
+// a header
+func dropSessionHeader(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := bytes.Cut(data, []byte("\n"))
+	if err := os.WriteFile(path, rest, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replayFixes returns receiver fixes one second apart
+func replayFixes(n int) []Packet {
+	packets := make([]Packet, n)
+	for i := range packets {
+		packets[i] = Packet{
+			DeviceTime: time.Date(2026, time.October, 16, 12, 0, i, 0, time.UTC),
+			Latitude:   54.6872,
+			Longitude:  25.2797,
+			Satellites: 9,
+			Fix:        Fix3D,
+			GNSS:       HasFix,
+		}
+	}
+	return packets
+}
+
+// replay plays a session back through a source manager and returns the
+// number of packets received and the writer's counters
+func replay(t *testing.T, src PacketSource) (int, DBWriterStats) {
+	t.Helper()
+	spool, err := OpenSpool(filepath.Join(t.TempDir(), "spool.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DBWriterConfig{QueueSize: 100, BatchSize: 10, FlushInterval: time.Hour, Policy: QueueBlock}
+	writer := NewDBWriter(nil, "", spool, cfg, func() {})
+
+	out := make(chan SourceEvent, 100)
+	events := make(chan ConnEvent, 16)
+	m := NewSourceManager(new(app.Window), out, events, writer, &Recorder{})
+	if err := m.Start(src); err != nil {
+		t.Fatal(err)
+	}
+	for ev := range events {
+		if ev.State == StateDisconnected {
+			break
+		}
+	}
+	m.Close()
+	writer.Close()
+
+	packets := 0
+	for len(out) > 0 {
+		ev := <-out
+		if ev.Err != nil {
+			t.Errorf("replay error: %v", ev.Err)
+		} else if !ev.Fragment {
+			packets++
+		}
+	}
+	return packets, writer.Stats()
+}
+
+func TestReplayIsNotStored(t *testing.T) {
+	for _, proto := range []Protocol{ProtocolNMEA, ProtocolUBX, ProtocolBinary} {
+		t.Run(string(proto), func(t *testing.T) {
+			path := writeSession(t, proto, replayFixes(5))
+			dropSessionHeader(t, path)
+			src, err := ParseSourceSpec("replay://" + path + "?speed=1000")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			packets, stats := replay(t, WithProtocol(src, proto))
+			if packets == 0 {
+				t.Fatal("no packets replayed")
+			}
+			if stats.Spooled != 0 || stats.Written != 0 {
+				t.Errorf("replayed packets were stored: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestReplayUsesRecordedProtocol(t *testing.T) {
+	for _, proto := range []Protocol{ProtocolText, ProtocolNMEA, ProtocolUBX, ProtocolBinary} {
+		t.Run(string(proto), func(t *testing.T) {
+			fixes := replayFixes(5)
+			for i := range fixes {
+				fixes[i].DeviceID = "DEV1"
+				fixes[i].Time = fixes[i].DeviceTime.Format("15:04:05.000")
+			}
+			path := writeSession(t, proto, fixes)
+			src, err := ParseSourceSpec("replay://" + path + "?speed=1000")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := protocolOf(src); got != proto {
+				t.Fatalf("protocol %q, want %q", got, proto)
+			}
+
+			// The protocol picked for the source does not override the
+			// recorded one
+			packets, _ := replay(t, WithProtocol(src, ProtocolText))
+			if packets == 0 {
+				t.Fatal("no packets replayed")
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const (
+	consoleCapacity        = 200
+	consoleHistoryCapacity = 10
+)
+
+// lineEndingOptions are the terminators that can be appended to commands
+var lineEndingOptions = []string{"CRLF", "LF", "CR", "None"}
+
+// Console holds the command console: commands sent to the device, its
+// non-packet responses and the command history
+type Console struct {
+	Lines   []string
+	History []string
+
+	Editor      widget.Editor
+	SendBtn     widget.Clickable
+	LineEnding  widget.Enum
+	Presets     []string
+	PresetBtns  []widget.Clickable
+	HistoryBtns [consoleHistoryCapacity]widget.Clickable
+}
+
+// NewConsole creates a console with the given predefined commands
+func NewConsole(presets []string) *Console {
+	c := &Console{
+		Presets:    presets,
+		PresetBtns: make([]widget.Clickable, len(presets)),
+	}
+	c.Editor.SingleLine = true
+	c.Editor.Submit = true
+	c.LineEnding.Value = lineEndingOptions[0]
+	return c
+}
+
+// ParsePresets splits a comma separated list of predefined commands
+func ParsePresets(list string) []string {
+	var presets []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			presets = append(presets, p)
+		}
+	}
+	return presets
+}
+
+// AddLine appends a line to the console, keeping at most consoleCapacity
+func (c *Console) AddLine(line string) {
+	c.Lines = append(c.Lines, line)
+	if len(c.Lines) > consoleCapacity {
+		c.Lines = c.Lines[len(c.Lines)-consoleCapacity:]
+	}
+}
+
+// Terminator returns the selected line ending
+func (c *Console) Terminator() string {
+	switch c.LineEnding.Value {
+	case "LF":
+		return "\n"
+	case "CR":
+		return "\r"
+	case "None":
+		return ""
+	default:
+		return "\r\n"
+	}
+}
+
+// Update processes input events and returns a command to send, if the user
+// submitted one, picked a preset or clicked a history entry
+func (c *Console) Update(gtx layout.Context) (string, bool) {
+	cmd, ok := "", false
+
+	for {
+		ev, more := c.Editor.Update(gtx)
+		if !more {
+			break
+		}
+		if _, submit := ev.(widget.SubmitEvent); submit {
+			cmd, ok = c.Editor.Text(), true
+		}
+	}
+	if c.SendBtn.Clicked(gtx) {
+		cmd, ok = c.Editor.Text(), true
+	}
+	for i := range c.PresetBtns {
+		if c.PresetBtns[i].Clicked(gtx) {
+			cmd, ok = c.Presets[i], true
+		}
+	}
+	for i := range c.History {
+		if c.HistoryBtns[i].Clicked(gtx) {
+			cmd, ok = c.History[i], true
+		}
+	}
+
+	cmd = strings.TrimSpace(cmd)
+	if !ok || cmd == "" {
+		return "", false
+	}
+	c.Editor.SetText("")
+	c.remember(cmd)
+	return cmd, true
+}
+
+// remember puts a command at the front of the history without duplicates
+func (c *Console) remember(cmd string) {
+	history := []string{cmd}
+	for _, h := range c.History {
+		if h != cmd && len(history) < consoleHistoryCapacity {
+			history = append(history, h)
+		}
+	}
+	c.History = history
+}
+
+// isResponseLine reports whether a text protocol line that failed to parse
+// is a device reply rather than damaged telemetry; packets always contain
+// several semicolon separated fields
+func isResponseLine(raw string) bool {
+	return strings.Count(raw, ";") < 2
+}
+
+// isNMEAResponse reports whether a line that failed to decode in NMEA mode
+// is a device reply: every sentence starts with '$', replies are plain text
+func isNMEAResponse(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	return raw != "" && raw[0] != '$' && isPrintable(raw)
+}
+
+// isTextReply reports whether a frame that failed to decode in a binary
+// protocol is a device reply: a line of printable text
+func isTextReply(frame string) bool {
+	frame = strings.TrimRight(frame, "\r\n\x00")
+	return frame != "" && isPrintable(frame)
+}
+
+// isPrintable reports whether s is printable ASCII text
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < ' ' || c > '~') && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func consolePanel(gtx layout.Context, th *material.Theme, c *Console) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			children := make([]layout.FlexChild, 0, len(c.Lines))
+			for i := len(c.Lines) - 1; i >= 0; i-- {
+				line := c.Lines[i]
+				children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Body2(th, line).Layout(gtx)
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return material.Editor(th, &c.Editor, "Komanda...").Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+						return material.Button(th, &c.SendBtn, "Siųsti").Layout(gtx)
+					})
+				}),
+			)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Eilutės pabaiga:", &c.LineEnding, lineEndingOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return commandButtons(gtx, th, c.PresetBtns, c.Presets)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if len(c.History) == 0 {
+				return layout.Dimensions{}
+			}
+			return layout.Inset{Top: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return material.Body2(th, "Istorija:").Layout(gtx)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return commandButtons(gtx, th, c.HistoryBtns[:len(c.History)], c.History)
+					}),
+				)
+			})
+		}),
+	)
+}
+
+func commandButtons(gtx layout.Context, th *material.Theme, btns []widget.Clickable, labels []string) layout.Dimensions {
+	children := make([]layout.FlexChild, 0, len(labels))
+	for i := range labels {
+		btn, label := &btns[i], labels[i]
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(4), Right: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return material.Button(th, btn, label).Layout(gtx)
+			})
+		}))
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -17,16 +18,36 @@ type Database struct {
 }
 
 type StoredPacket struct {
-	ID            int64     `json:"id"`
-	Time          string    `json:"time"`
-	Latitude      float64   `json:"latitude"`
-	Longitude     float64   `json:"longitude"`
-	Satellites    int       `json:"satellites"`
-	AccelerationX float64   `json:"acceleration_x"`
-	AccelerationY float64   `json:"acceleration_y"`
-	AccelerationZ float64   `json:"acceleration_z"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID             int64           `json:"id"`
+	DeviceID       string          `json:"device_id"`
+	Sequence       *int64          `json:"sequence"`
+	Time           string          `json:"time"`
+	DeviceTime     *time.Time      `json:"device_time"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	Latitude       float64         `json:"latitude"`
+	Longitude      float64         `json:"longitude"`
+	Satellites     int             `json:"satellites"`
+	Altitude       *float64        `json:"altitude"`
+	Speed          *float64        `json:"speed"`
+	Course         *float64        `json:"course"`
+	HDOP           *float64        `json:"hdop"`
+	PDOP           *float64        `json:"pdop"`
+	FixType        *string         `json:"fix_type"`
+	AccelerationX  float64         `json:"acceleration_x"`
+	AccelerationY  float64         `json:"acceleration_y"`
+	AccelerationZ  float64         `json:"acceleration_z"`
+	GyroX          *float64        `json:"gyro_x"`
+	GyroY          *float64        `json:"gyro_y"`
+	GyroZ          *float64        `json:"gyro_z"`
+	MagX           *float64        `json:"mag_x"`
+	MagY           *float64        `json:"mag_y"`
+	MagZ           *float64        `json:"mag_z"`
+	Temperature    *float64        `json:"temperature"`
+	ChecksumStatus string          `json:"checksum_status"`
+	Suspect        bool            `json:"suspect"`
+	Extra          json.RawMessage `json:"extra,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
 }
 
 // NewDatabase creates a new database connection
@@ -49,6 +70,11 @@ func NewDatabase(dsn string) (*Database, error) {
 	return &Database{db: db}, nil
 }
 
+// Ping checks that the database is still reachable
+func (d *Database) Ping() error {
+	return d.db.Ping()
+}
+
 // Close closes the database connection
 func (d *Database) Close() error {
 	if d.db != nil {
@@ -57,43 +83,170 @@ func (d *Database) Close() error {
 	return nil
 }
 
+// insertColumns are the columns written for every packet, in the order of
+// packetArgs
+const insertColumns = `device_id, sequence, time, device_time, received_at, latitude, longitude, satellites,
+	altitude, speed, course, hdop, pdop, fix_type,
+	acceleration_x, acceleration_y, acceleration_z,
+	gyro_x, gyro_y, gyro_z, mag_x, mag_y, mag_z, temperature,
+	checksum_status, suspect, extra`
+
+const insertColumnCount = 27
+
+// maxInsertRows keeps a multi-row INSERT below MySQL's 65535 placeholders
+const maxInsertRows = 65535 / insertColumnCount
+
+// insertPlaceholders is one "(?, ?, ...)" row for insertColumns
+var insertPlaceholders = "(" + strings.TrimSuffix(strings.Repeat("?, ", insertColumnCount), ", ") + ")"
+
 // InsertPacket inserts a packet into the database
 func (d *Database) InsertPacket(packet Packet) (int64, error) {
-	query := `
-		INSERT INTO packets (time, latitude, longitude, satellites, acceleration_x, acceleration_y, acceleration_z)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`
+	args, err := packetArgs(packet)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO packets (" + insertColumns + ") VALUES " + insertPlaceholders
+	result, err := d.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert packet: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	return id, nil
+}
+
+// InsertPackets inserts packets in order with multi-row INSERTs inside one
+// transaction, so either all of them are stored or none
+func (d *Database) InsertPackets(packets []Packet) error {
+	if len(packets) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(packets); start += maxInsertRows {
+		chunk := packets[start:min(start+maxInsertRows, len(packets))]
+
+		rows := make([]string, len(chunk))
+		args := make([]any, 0, len(chunk)*insertColumnCount)
+		for i, packet := range chunk {
+			values, err := packetArgs(packet)
+			if err != nil {
+				return err
+			}
+			rows[i] = insertPlaceholders
+			args = append(args, values...)
+		}
+
+		query := "INSERT INTO packets (" + insertColumns + ") VALUES " + strings.Join(rows, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to insert %d packets: %w", len(chunk), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit packets: %w", err)
+	}
+	return nil
+}
+
+// packetArgs converts a packet into the values of insertColumns
+func packetArgs(packet Packet) ([]any, error) {
+	var sequence *int64
+	if packet.HasSeq {
+		seq := int64(packet.Seq)
+		sequence = &seq
+	}
 
-	result, err := d.db.Exec(query,
+	var deviceTime *time.Time
+	if !packet.DeviceTime.IsZero() {
+		t := packet.DeviceTime.UTC()
+		deviceTime = &t
+	}
+
+	receivedAt := packet.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+
+	checksum := packet.Checksum
+	if checksum == "" {
+		checksum = ChecksumNone
+	}
+
+	var extra []byte
+	if len(packet.Extra) > 0 {
+		data, err := json.Marshal(packet.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode extra fields: %w", err)
+		}
+		extra = data
+	}
+
+	return []any{
+		packet.DeviceID,
+		sequence,
 		packet.Time,
+		deviceTime,
+		receivedAt.UTC(),
 		packet.Latitude,
 		packet.Longitude,
 		packet.Satellites,
+		gnssValue(packet, HasAltitude, packet.Altitude),
+		gnssValue(packet, HasSpeed, packet.Speed),
+		gnssValue(packet, HasCourse, packet.Course),
+		gnssValue(packet, HasHDOP, packet.HDOP),
+		gnssValue(packet, HasPDOP, packet.PDOP),
+		gnssValue(packet, HasFix, packet.Fix.String()),
 		packet.Acceleration[0],
 		packet.Acceleration[1],
 		packet.Acceleration[2],
-	)
+		imuValue(packet, HasGyro, packet.Gyro[0]),
+		imuValue(packet, HasGyro, packet.Gyro[1]),
+		imuValue(packet, HasGyro, packet.Gyro[2]),
+		imuValue(packet, HasMagnetometer, packet.Magnetometer[0]),
+		imuValue(packet, HasMagnetometer, packet.Magnetometer[1]),
+		imuValue(packet, HasMagnetometer, packet.Magnetometer[2]),
+		imuValue(packet, HasTemperature, packet.Temperature),
+		string(checksum),
+		packet.Suspect,
+		extra,
+	}, nil
+}
 
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert packet: %w", err)
+// gnssValue returns v for an optional GNSS column, or NULL when the packet
+// did not report the field
+func gnssValue(packet Packet, field GNSSFields, v any) any {
+	if !packet.GNSS.Has(field) {
+		return nil
 	}
+	return v
+}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+// imuValue returns v for an optional IMU column, or NULL when the packet
+// did not report the field
+func imuValue(packet Packet, field IMUFields, v float64) any {
+	if !packet.IMU.Has(field) {
+		return nil
 	}
-
-	return id, nil
+	return v
 }
 
 // GetPackets retrieves packets from the database with optional limit
 func (d *Database) GetPackets(limit int) ([]StoredPacket, error) {
 	query := `
-		SELECT id, time, latitude, longitude, satellites, 
-		       acceleration_x, acceleration_y, acceleration_z, 
-		       created_at, updated_at
+		SELECT ` + packetColumns + `
 		FROM packets 
-		ORDER BY created_at DESC
+		ORDER BY received_at DESC
 	`
 
 	if limit > 0 {
@@ -106,21 +259,87 @@ func (d *Database) GetPackets(limit int) ([]StoredPacket, error) {
 	}
 	defer rows.Close()
 
+	return scanPackets(rows)
+}
+
+// GetPacketsBetween retrieves packets received in [from, to), oldest first
+func (d *Database) GetPacketsBetween(from, to time.Time) ([]StoredPacket, error) {
+	query := `
+		SELECT ` + packetColumns + `
+		FROM packets 
+		WHERE received_at >= ? AND received_at < ?
+		ORDER BY received_at ASC
+	`
+
+	rows, err := d.db.Query(query, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query packets: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPackets(rows)
+}
+
+// packetColumns lists the columns scanned by scanPacket, in order
+const packetColumns = `id, device_id, sequence, time, device_time, received_at,
+		       latitude, longitude, satellites, 
+		       altitude, speed, course, hdop, pdop, fix_type,
+		       acceleration_x, acceleration_y, acceleration_z, 
+		       gyro_x, gyro_y, gyro_z, mag_x, mag_y, mag_z, temperature,
+		       checksum_status, suspect, extra, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPacket reads one row selected with packetColumns
+func scanPacket(row rowScanner) (StoredPacket, error) {
+	var p StoredPacket
+	var extra []byte
+	err := row.Scan(
+		&p.ID,
+		&p.DeviceID,
+		&p.Sequence,
+		&p.Time,
+		&p.DeviceTime,
+		&p.ReceivedAt,
+		&p.Latitude,
+		&p.Longitude,
+		&p.Satellites,
+		&p.Altitude,
+		&p.Speed,
+		&p.Course,
+		&p.HDOP,
+		&p.PDOP,
+		&p.FixType,
+		&p.AccelerationX,
+		&p.AccelerationY,
+		&p.AccelerationZ,
+		&p.GyroX,
+		&p.GyroY,
+		&p.GyroZ,
+		&p.MagX,
+		&p.MagY,
+		&p.MagZ,
+		&p.Temperature,
+		&p.ChecksumStatus,
+		&p.Suspect,
+		&extra,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if len(extra) > 0 {
+		p.Extra = json.RawMessage(extra)
+	}
+	return p, err
+}
+
+// scanPackets reads all rows selected with packetColumns
+func scanPackets(rows *sql.Rows) ([]StoredPacket, error) {
 	var packets []StoredPacket
 	for rows.Next() {
-		var p StoredPacket
-		err := rows.Scan(
-			&p.ID,
-			&p.Time,
-			&p.Latitude,
-			&p.Longitude,
-			&p.Satellites,
-			&p.AccelerationX,
-			&p.AccelerationY,
-			&p.AccelerationZ,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		)
+		p, err := scanPacket(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan packet: %w", err)
 		}
@@ -137,27 +356,13 @@ func (d *Database) GetPackets(limit int) ([]StoredPacket, error) {
 // GetLatestPacket retrieves the most recent packet from the database
 func (d *Database) GetLatestPacket() (*StoredPacket, error) {
 	query := `
-		SELECT id, time, latitude, longitude, satellites, 
-		       acceleration_x, acceleration_y, acceleration_z, 
-		       created_at, updated_at
+		SELECT ` + packetColumns + `
 		FROM packets 
-		ORDER BY created_at DESC 
+		ORDER BY received_at DESC 
 		LIMIT 1
 	`
 
-	var p StoredPacket
-	err := d.db.QueryRow(query).Scan(
-		&p.ID,
-		&p.Time,
-		&p.Latitude,
-		&p.Longitude,
-		&p.Satellites,
-		&p.AccelerationX,
-		&p.AccelerationY,
-		&p.AccelerationZ,
-		&p.CreatedAt,
-		&p.UpdatedAt,
-	)
+	p, err := scanPacket(d.db.QueryRow(query))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -188,12 +393,15 @@ func (d *Database) DeleteAllPackets() error {
 	return nil
 }
 
-// GetAccelerationSeries retrieves acceleration Z values for graphing
-func (d *Database) GetAccelerationSeries(limit int) ([]float32, error) {
+// GetChannelSeries retrieves the values of a graph channel and their
+// receive times for graphing; packets without the channel are skipped
+func (d *Database) GetChannelSeries(channel GraphChannel, limit int) ([]float32, []time.Time, error) {
+	// Column names come from graphChannels, never from user input
 	query := `
-		SELECT acceleration_z 
+		SELECT ` + channel.Column + `, received_at 
 		FROM packets 
-		ORDER BY created_at ASC
+		WHERE ` + channel.Column + ` IS NOT NULL
+		ORDER BY received_at ASC
 	`
 
 	if limit > 0 {
@@ -202,30 +410,36 @@ func (d *Database) GetAccelerationSeries(limit int) ([]float32, error) {
 
 	rows, err := d.db.Query(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query acceleration series: %w", err)
+		return nil, nil, fmt.Errorf("failed to query %s series: %w", channel.Name, err)
 	}
 	defer rows.Close()
 
 	var series []float32
+	var times []time.Time
 	for rows.Next() {
 		var value float64
-		if err := rows.Scan(&value); err != nil {
-			return nil, fmt.Errorf("failed to scan acceleration value: %w", err)
+		var at time.Time
+		if err := rows.Scan(&value, &at); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan %s value: %w", channel.Name, err)
 		}
 		series = append(series, float32(value))
+		times = append(times, at)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating acceleration values: %w", err)
+		return nil, nil, fmt.Errorf("error iterating %s values: %w", channel.Name, err)
 	}
 
-	return series, nil
+	return series, times, nil
 }
 
 // CreateTestPacket creates a test packet with mock data
 func CreateTestPacket() Packet {
+	now := time.Now()
 	return Packet{
-		Time:       time.Now().Format("15:04:05"),
+		Time:       now.In(deviceLocation).Format("15:04:05.000"),
+		DeviceTime: now,
+		ReceivedAt: now,
 		Latitude:   54.687157 + (float64(time.Now().UnixNano()%1000) / 100000.0), // Vilnius area with variation
 		Longitude:  25.279652 + (float64(time.Now().UnixNano()%1000) / 100000.0), // Vilnius area with variation
 		Satellites: 8 + int(time.Now().UnixNano()%5),                             // 8-12 satellites
@@ -251,7 +465,9 @@ func getDatabaseDSN() string {
 	password := getEnvOrDefault("DB_PASSWORD", "")
 	dbname := getEnvOrDefault("DB_NAME", "komkomunikacijos")
 
-	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", user, password, host, port, dbname)
+	// Times are stored in UTC; a UTC session keeps column defaults such as
+	// CURRENT_TIMESTAMP in the same zone
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&time_zone=%%27%%2B00%%3A00%%27", user, password, host, port, dbname)
 }
 
 // getEnvOrDefault returns environment variable value or default if not set
@@ -283,9 +499,11 @@ func (d *Database) SavePacketsToCSV(filename string, limit int) error {
 
 	// Write header
 	header := []string{
-		"ID", "Time", "Latitude", "Longitude", "Satellites",
+		"ID", "DeviceID", "Sequence", "Time", "DeviceTime", "ReceivedAt", "Latitude", "Longitude", "Satellites",
+		"Altitude", "Speed", "Course", "HDOP", "PDOP", "FixType",
 		"AccelerationX", "AccelerationY", "AccelerationZ",
-		"CreatedAt", "UpdatedAt",
+		"GyroX", "GyroY", "GyroZ", "MagX", "MagY", "MagZ", "Temperature",
+		"ChecksumStatus", "Suspect", "Extra", "CreatedAt", "UpdatedAt",
 	}
 	if err := writer.Write(header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
@@ -295,13 +513,33 @@ func (d *Database) SavePacketsToCSV(filename string, limit int) error {
 	for _, p := range packets {
 		row := []string{
 			strconv.FormatInt(p.ID, 10),
+			p.DeviceID,
+			formatSequence(p.Sequence),
 			p.Time,
+			formatTimestamp(p.DeviceTime),
+			p.ReceivedAt.UTC().Format(timestampLayout),
 			strconv.FormatFloat(p.Latitude, 'f', 6, 64),
 			strconv.FormatFloat(p.Longitude, 'f', 6, 64),
 			strconv.Itoa(p.Satellites),
+			formatOptional(p.Altitude, 1),
+			formatOptional(p.Speed, 2),
+			formatOptional(p.Course, 1),
+			formatOptional(p.HDOP, 2),
+			formatOptional(p.PDOP, 2),
+			formatOptionalString(p.FixType),
 			strconv.FormatFloat(p.AccelerationX, 'f', 3, 64),
 			strconv.FormatFloat(p.AccelerationY, 'f', 3, 64),
 			strconv.FormatFloat(p.AccelerationZ, 'f', 3, 64),
+			formatOptional(p.GyroX, 3),
+			formatOptional(p.GyroY, 3),
+			formatOptional(p.GyroZ, 3),
+			formatOptional(p.MagX, 2),
+			formatOptional(p.MagY, 2),
+			formatOptional(p.MagZ, 2),
+			formatOptional(p.Temperature, 2),
+			p.ChecksumStatus,
+			strconv.FormatBool(p.Suspect),
+			string(p.Extra),
 			p.CreatedAt.Format("2006-01-02 15:04:05"),
 			p.UpdatedAt.Format("2006-01-02 15:04:05"),
 		}
@@ -313,6 +551,41 @@ func (d *Database) SavePacketsToCSV(filename string, limit int) error {
 	return nil
 }
 
+// formatSequence renders an optional sequence number for CSV export
+func formatSequence(seq *int64) string {
+	if seq == nil {
+		return ""
+	}
+	return strconv.FormatInt(*seq, 10)
+}
+
+// formatOptional renders an optional number for CSV export
+func formatOptional(v *float64, prec int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', prec, 64)
+}
+
+// formatOptionalString renders an optional string for CSV export
+func formatOptionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// timestampLayout is the millisecond precision ISO 8601 form used in exports
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// formatTimestamp renders an optional timestamp for CSV export
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
 // SavePacketsToJSON exports packets to a JSON file
 func (d *Database) SavePacketsToJSON(filename string, limit int) error {
 	// Get packets from database
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// QueuePolicy decides what happens to a packet when the write queue is full
+type QueuePolicy string
+
+const (
+	// QueueBlock makes the reader wait, pushing back on the source
+	QueueBlock QueuePolicy = "block"
+	// QueueDropOldest discards the oldest queued packet
+	QueueDropOldest QueuePolicy = "drop-oldest"
+	// QueueDropNewest discards the packet being added
+	QueueDropNewest QueuePolicy = "drop-newest"
+)
+
+// DBWriterConfig sizes the write queue and its batches
+type DBWriterConfig struct {
+	QueueSize     int
+	BatchSize     int           // packets per transaction
+	FlushInterval time.Duration // longest a packet waits for a full batch
+	Policy        QueuePolicy
+}
+
+// dbWriterConfig is set from the command line
+var dbWriterConfig = DBWriterConfig{QueueSize: 10000, BatchSize: 200, FlushInterval: 500 * time.Millisecond, Policy: QueueBlock}
+
+const (
+	dbWriteAttempts     = 3
+	dbWriteRetryDelay   = time.Second
+	dbReconnectInterval = 5 * time.Second
+)
+
+// NewDBWriterConfig validates the command line settings of the writer
+func NewDBWriterConfig(queueSize, batchSize int, flush time.Duration, policy string) (DBWriterConfig, error) {
+	cfg := DBWriterConfig{QueueSize: queueSize, BatchSize: batchSize, FlushInterval: flush, Policy: QueuePolicy(policy)}
+	switch cfg.Policy {
+	case QueueBlock, QueueDropOldest, QueueDropNewest:
+	default:
+		return cfg, fmt.Errorf("unknown queue policy %q (use block, drop-oldest or drop-newest)", policy)
+	}
+	if queueSize < 1 {
+		return cfg, fmt.Errorf("invalid queue size %d", queueSize)
+	}
+	if batchSize < 1 || batchSize > queueSize {
+		return cfg, fmt.Errorf("invalid batch size %d (must be 1-%d)", batchSize, queueSize)
+	}
+	if flush <= 0 {
+		return cfg, fmt.Errorf("invalid flush interval %v", flush)
+	}
+	return cfg, nil
+}
+
+// DBWriterStats is a snapshot of the writer for the UI
+type DBWriterStats struct {
+	Connected bool
+	Queued    int // packets waiting in the queue
+	Capacity  int
+	Written   int64
+	Dropped   int64 // discarded by the queue policy
+	Failed    int64 // lost: not written and not spooled
+	Spooled   int   // packets in the offline spool waiting for the database
+	SpoolSize int64 // bytes
+	LastErr   error
+}
+
+// DBWriter stores packets from a bounded queue in arrival order, in
+// batched transactions written by a single goroutine. While the database
+// is unreachable packets go to the spool, and once a reconnect succeeds
+// the spool is replayed before new packets are written directly
+type DBWriter struct {
+	dsn     string
+	spool   *Spool // nil when it could not be opened; only used by run
+	cfg     DBWriterConfig
+	changed func()
+	queue   chan Packet
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	online    atomic.Bool
+	written   atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+	spooled   atomic.Int64
+	spoolSize atomic.Int64
+
+	mu      sync.Mutex
+	db      *Database
+	lastErr error
+}
+
+// NewDBWriter starts a writer for db, which is nil if the database could
+// not be reached at startup; dsn is used to connect later. spool may be
+// nil, in which case packets are lost while the database is down.
+// changed is called when the connection state changes
+func NewDBWriter(db *Database, dsn string, spool *Spool, cfg DBWriterConfig, changed func()) *DBWriter {
+	w := &DBWriter{
+		dsn:     dsn,
+		spool:   spool,
+		cfg:     cfg,
+		changed: changed,
+		queue:   make(chan Packet, cfg.QueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		db:      db,
+	}
+	w.online.Store(db != nil)
+	w.updateSpoolStats()
+	go w.run()
+	return w
+}
+
+// Enqueue adds a packet to the queue, applying the queue policy when it is
+// full; it reports false if the packet was not queued
+func (w *DBWriter) Enqueue(p Packet) bool {
+	select {
+	case w.queue <- p:
+		return true
+	case <-w.stop:
+		return false
+	default:
+	}
+
+	switch w.cfg.Policy {
+	case QueueDropNewest:
+		w.dropped.Add(1)
+		return false
+	case QueueDropOldest:
+		for {
+			select {
+			case w.queue <- p:
+				return true
+			case <-w.stop:
+				return false
+			default:
+			}
+			select {
+			case <-w.queue:
+				w.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case w.queue <- p:
+			return true
+		case <-w.stop:
+			return false
+		}
+	}
+}
+
+// Close writes the packets still queued, to the database or the spool,
+// and closes both
+func (w *DBWriter) Close() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// Database returns the connection while the database is reachable, nil
+// otherwise
+func (w *DBWriter) Database() *Database {
+	if !w.online.Load() {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.db
+}
+
+// Stats returns the current queue depth and counters
+func (w *DBWriter) Stats() DBWriterStats {
+	w.mu.Lock()
+	lastErr := w.lastErr
+	w.mu.Unlock()
+	return DBWriterStats{
+		Connected: w.online.Load(),
+		Queued:    len(w.queue),
+		Capacity:  cap(w.queue),
+		Written:   w.written.Load(),
+		Dropped:   w.dropped.Load(),
+		Failed:    w.failed.Load(),
+		Spooled:   int(w.spooled.Load()),
+		SpoolSize: w.spoolSize.Load(),
+		LastErr:   lastErr,
+	}
+}
+
+func (w *DBWriter) run() {
+	defer close(w.done)
+	defer w.closeAll()
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	retry := time.NewTicker(dbReconnectInterval)
+	defer retry.Stop()
+
+	// Always ready; selected to replay the spool between other work
+	ready := make(chan struct{})
+	close(ready)
+
+	batch := make([]Packet, 0, w.cfg.BatchSize)
+	for {
+		var replay <-chan struct{}
+		if w.online.Load() && w.spool != nil && w.spool.Backlog() > 0 {
+			replay = ready
+		}
+
+		select {
+		case p := <-w.queue:
+			batch = append(batch, p)
+			if len(batch) >= w.cfg.BatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-retry.C:
+			if !w.online.Load() {
+				w.reconnect()
+			}
+		case <-replay:
+			w.replay()
+		case <-w.stop:
+			for {
+				select {
+				case p := <-w.queue:
+					batch = append(batch, p)
+					if len(batch) >= w.cfg.BatchSize {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a batch and returns it emptied. While the database is down
+// or spooled packets are still waiting, the batch is spooled to keep
+// arrival order
+func (w *DBWriter) flush(batch []Packet) []Packet {
+	if len(batch) == 0 {
+		return batch
+	}
+	if w.spool != nil && (!w.online.Load() || w.spool.Backlog() > 0) {
+		w.toSpool(batch)
+		return batch[:0]
+	}
+	if !w.online.Load() {
+		w.failed.Add(int64(len(batch)))
+		return batch[:0]
+	}
+
+	// With a spool there is no need to hold the queue up with retries
+	attempts := dbWriteAttempts
+	if w.spool != nil {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = w.db.InsertPackets(batch); err == nil || !isConnectionError(err) {
+			break
+		}
+		if attempt < attempts {
+			select {
+			case <-time.After(dbWriteRetryDelay):
+			case <-w.stop:
+				// Shutting down: retry without waiting
+			}
+		}
+	}
+
+	rest := batch[:0]
+	switch {
+	case err == nil:
+		w.written.Add(int64(len(batch)))
+		w.setErr(nil)
+	case isConnectionError(err):
+		log.Printf("Failed to save %d packets to database: %v", len(batch), err)
+		w.setOffline(err)
+		rest = batch
+	default:
+		// The database refused the data; find the rows at fault
+		done, err := w.insertRows(batch)
+		if err != nil {
+			w.setOffline(err)
+		}
+		rest = batch[done:]
+	}
+
+	if len(rest) > 0 {
+		if w.spool != nil {
+			w.toSpool(rest)
+		} else {
+			w.failed.Add(int64(len(rest)))
+		}
+	}
+	return batch[:0]
+}
+
+// insertRows stores packets one at a time after a batch was refused,
+// dropping the packets the database rejects. It stops at a connection
+// error, returning it with the number of packets dealt with
+func (w *DBWriter) insertRows(packets []Packet) (int, error) {
+	for i, p := range packets {
+		err := w.db.InsertPackets(packets[i : i+1])
+		switch {
+		case err == nil:
+			w.written.Add(1)
+		case isConnectionError(err):
+			return i, err
+		default:
+			log.Printf("Database rejected packet %s/%d, dropping it: %v", p.DeviceID, p.Seq, err)
+			w.failed.Add(1)
+			w.setErr(err)
+		}
+	}
+	return len(packets), nil
+}
+
+// isConnectionError tells failures that may pass once the database is
+// reachable again from data the database refuses
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.As(err, &opErr) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1040, // too many connections
+			1053, // server shutdown in progress
+			1205, // lock wait timeout
+			1213, // deadlock
+			1290: // read-only server
+			return true
+		}
+	}
+	return false
+}
+
+// toSpool appends a batch to the spool, counting it as failed if even
+// that is not possible
+func (w *DBWriter) toSpool(batch []Packet) {
+	skipped, err := w.spool.Append(batch)
+	w.failed.Add(int64(skipped))
+	if err != nil {
+		log.Printf("Failed to spool %d packets: %v", len(batch)-skipped, err)
+		w.failed.Add(int64(len(batch) - skipped))
+		w.setErr(err)
+	}
+	w.updateSpoolStats()
+}
+
+// replay writes the oldest spooled batch to the database
+func (w *DBWriter) replay() {
+	packets, marks, end, err := w.spool.Peek(w.cfg.BatchSize)
+	if err != nil {
+		// Wait for the next reconnect before trying again
+		log.Printf("Failed to replay spool: %v", err)
+		w.setOffline(err)
+		return
+	}
+
+	err = w.db.InsertPackets(packets)
+	switch {
+	case err == nil:
+		w.written.Add(int64(len(packets)))
+	case isConnectionError(err):
+		log.Printf("Failed to replay %d spooled packets: %v", len(packets), err)
+		w.setOffline(err)
+		return
+	default:
+		// Drop the rows the database refuses so they cannot block the
+		// spool; stop after the last one stored if the connection fails
+		done, err := w.insertRows(packets)
+		if err != nil {
+			log.Printf("Failed to replay %d spooled packets: %v", len(packets)-done, err)
+			w.setOffline(err)
+			if done > 0 {
+				w.commitSpool(marks[done-1])
+			}
+			return
+		}
+	}
+	w.commitSpool(end)
+}
+
+func (w *DBWriter) commitSpool(mark SpoolMark) {
+	if err := w.spool.Commit(mark); err != nil {
+		log.Printf("Failed to update spool: %v", err)
+		w.setErr(err)
+	}
+	w.updateSpoolStats()
+}
+
+// reconnect opens the database if it never was, or pings it
+func (w *DBWriter) reconnect() {
+	w.mu.Lock()
+	db := w.db
+	w.mu.Unlock()
+
+	if db == nil {
+		var err error
+		if db, err = NewDatabase(w.dsn); err != nil {
+			w.setErr(err)
+			return
+		}
+		w.mu.Lock()
+		w.db = db
+		w.mu.Unlock()
+	} else if err := db.Ping(); err != nil {
+		w.setErr(err)
+		return
+	}
+
+	log.Println("Database connection re-established")
+	w.setErr(nil)
+	w.online.Store(true)
+	w.changed()
+}
+
+func (w *DBWriter) setOffline(err error) {
+	w.setErr(err)
+	if w.online.Swap(false) {
+		w.changed()
+	}
+}
+
+func (w *DBWriter) setErr(err error) {
+	w.mu.Lock()
+	w.lastErr = err
+	w.mu.Unlock()
+}
+
+func (w *DBWriter) updateSpoolStats() {
+	if w.spool == nil {
+		return
+	}
+	w.spooled.Store(int64(w.spool.Backlog()))
+	w.spoolSize.Store(w.spool.Size())
+}
+
+// closeAll releases the spool and the connection when the writer stops
+func (w *DBWriter) closeAll() {
+	if w.spool != nil {
+		if err := w.spool.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.db != nil {
+		w.db.Close()
+	}
+}
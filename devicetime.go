@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	_ "time/tzdata" // device zone must resolve on hosts without a zone database
+)
+
+// deviceLocation is the zone the boards report their clock in (EET/EEST
+// unless DEVICE_TZ says otherwise)
+var deviceLocation = loadDeviceLocation()
+
+// loadDeviceLocation resolves DEVICE_TZ, defaulting to Europe/Vilnius
+func loadDeviceLocation() *time.Location {
+	name := getEnvOrDefault("DEVICE_TZ", "Europe/Vilnius")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Unknown DEVICE_TZ %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// clockLayout accepts HH:MM:SS with an optional fraction
+const clockLayout = "15:04:05.999999999"
+
+var (
+	fullLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+	}
+)
+
+// ParseDeviceTime converts a device timestamp into a time.Time. Full ISO
+// timestamps are used as is (in loc when they carry no offset); bare
+// HH:MM:SS[.sss] clock times get their date from the host receive time,
+// picking the day that puts them closest to it so that packets sent just
+// before midnight and received just after keep the right date
+func ParseDeviceTime(raw string, received time.Time, loc *time.Location) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("empty device time")
+	}
+
+	// Only dates have dashes; a failed time.Parse allocates its error,
+	// which would cost every clock time three allocations
+	if strings.IndexByte(raw, '-') >= 0 {
+		for _, layout := range fullLayouts {
+			if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	if clock, err := time.Parse(clockLayout, raw); err == nil {
+		ref := received.In(loc)
+		t := time.Date(ref.Year(), ref.Month(), ref.Day(),
+			clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), loc)
+
+		switch diff := t.Sub(ref); {
+		case diff > 12*time.Hour:
+			t = t.AddDate(0, 0, -1)
+		case diff < -12*time.Hour:
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised device time %q", raw)
+}
+
+// stampPacket records when a packet was received and resolves its device
+// time unless the decoder already did; an unparsable device time leaves
+// DeviceTime zero and is returned
+func stampPacket(p *Packet, received time.Time) error {
+	p.ReceivedAt = received
+	if !p.DeviceTime.IsZero() || p.Time == "" {
+		return nil
+	}
+	t, err := ParseDeviceTime(p.Time, received, deviceLocation)
+	if err != nil {
+		return err
+	}
+	p.DeviceTime = t
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EncodePacket serializes a packet in a wire format, ready to be written
+// to a device stream. NMEA and UBX produce a group of sentences or messages
+// that the decoder assembles back into the packet
+func EncodePacket(proto Protocol, p Packet) ([]byte, error) {
+	switch proto {
+	case ProtocolText:
+		return []byte(FormatPacket(p, fieldSchema) + "\r\n"), nil
+	case ProtocolNMEA:
+		return encodeNMEA(p), nil
+	case ProtocolUBX:
+		return encodeUBX(p), nil
+	case ProtocolBinary:
+		return EncodeBinaryPacket(p)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", proto)
+	}
+}
+
+// FormatPacket renders a packet as a device line without line ending:
+// the fields the packet carries in schema order, then Extra sorted by
+// name, then the checksum trailer named by p.Checksum
+func FormatPacket(p Packet, schema *FieldSchema) string {
+	parts := []string{p.DeviceID}
+	add := func(name, value string) {
+		prefix := name + "-"
+		if spec, ok := schema.Spec(name); ok {
+			prefix = spec.Prefix
+		}
+		parts = append(parts, prefix+value)
+	}
+	axes := func(v [3]float64) string {
+		return formatFloat(v[0]) + "," + formatFloat(v[1]) + "," + formatFloat(v[2])
+	}
+
+	if p.HasSeq {
+		add("Seq", strconv.FormatUint(uint64(p.Seq), 10))
+	}
+	add("Time", p.Time)
+	add("Latitude", formatFloat(p.Latitude))
+	add("Longitude", formatFloat(p.Longitude))
+	add("Satellites", strconv.Itoa(p.Satellites))
+	for _, f := range []struct {
+		name  string
+		flag  GNSSFields
+		value float64
+	}{
+		{"Altitude", HasAltitude, p.Altitude},
+		{"Speed", HasSpeed, p.Speed},
+		{"Course", HasCourse, p.Course},
+		{"HDOP", HasHDOP, p.HDOP},
+		{"PDOP", HasPDOP, p.PDOP},
+	} {
+		if p.GNSS.Has(f.flag) {
+			add(f.name, formatFloat(f.value))
+		}
+	}
+	if p.GNSS.Has(HasFix) {
+		add("Fix", p.Fix.String())
+	}
+	add("Acceleration", axes(p.Acceleration))
+	if p.IMU.Has(HasGyro) {
+		add("Gyro", axes(p.Gyro))
+	}
+	if p.IMU.Has(HasMagnetometer) {
+		add("Magnetometer", axes(p.Magnetometer))
+	}
+	if p.IMU.Has(HasTemperature) {
+		add("Temperature", formatFloat(p.Temperature))
+	}
+
+	names := make([]string, 0, len(p.Extra))
+	for name := range p.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, formatValue(p.Extra[name]))
+	}
+
+	return AppendChecksum(strings.Join(parts, ";"), p.Checksum)
+}
+
+// formatFloat uses the shortest representation that parses back to v
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatValue renders a decoded field value the way FieldSpec.Decode reads it
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return formatFloat(v)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatValue(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// encodeNMEA writes RMC, VTG and GSA sentences followed by the GGA that
+// completes the packet in NMEAAssembler
+func encodeNMEA(p Packet) []byte {
+	talker := "GP"
+	if t, ok := strings.CutPrefix(p.DeviceID, "NMEA-"); ok && len(t) == 2 {
+		talker = t
+	}
+
+	var clock, date string
+	if t, ok := packetUTC(p); ok {
+		clock = t.Format("150405.000")
+		if !p.DeviceTime.IsZero() {
+			date = t.Format("020106")
+		}
+	}
+
+	lat, ns := nmeaCoordinate(p.Latitude, 2, "N", "S")
+	lon, ew := nmeaCoordinate(p.Longitude, 3, "E", "W")
+	fixed := p.Latitude != 0 || p.Longitude != 0
+	if !fixed {
+		lat, ns, lon, ew = "", "", "", ""
+	}
+	optional := func(flag GNSSFields, v float64, prec int) string {
+		if !p.GNSS.Has(flag) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+
+	status, quality := "V", "0"
+	if fixed {
+		status, quality = "A", "1"
+	}
+	knots := ""
+	if p.GNSS.Has(HasSpeed) {
+		knots = strconv.FormatFloat(p.Speed/knotsToKmh, 'f', 3, 64)
+	}
+	mode := ""
+	if p.GNSS.Has(HasFix) {
+		mode = strconv.Itoa(int(p.Fix) + 1)
+	}
+
+	var b strings.Builder
+	sentence := func(kind string, fields ...string) {
+		line := "$" + talker + kind + "," + strings.Join(fields, ",")
+		b.WriteString(AppendChecksum(line, ChecksumXOR) + "\r\n")
+	}
+	sentence("RMC", clock, status, lat, ns, lon, ew, knots, optional(HasCourse, p.Course, 2), date, "", "")
+	sentence("VTG", optional(HasCourse, p.Course, 2), "T", "", "M", knots, "N", optional(HasSpeed, p.Speed, 3), "K")
+	gsa := append([]string{"A", mode}, make([]string, 12)...) // no satellite PRNs
+	sentence("GSA", append(gsa, optional(HasPDOP, p.PDOP, 2), optional(HasHDOP, p.HDOP, 2), "")...)
+	sentence("GGA", clock, lat, ns, lon, ew, quality, strconv.Itoa(p.Satellites),
+		optional(HasHDOP, p.HDOP, 2), optional(HasAltitude, p.Altitude, 1), "M", "", "M", "", "")
+	return []byte(b.String())
+}
+
+// nmeaCoordinate formats decimal degrees as ddmm.mmmmmm with the given
+// number of degree digits and a hemisphere letter
+func nmeaCoordinate(v float64, digits int, pos, neg string) (string, string) {
+	hemi := pos
+	if v < 0 {
+		hemi, v = neg, -v
+	}
+	// Round in minutes first so 59.9999999' does not print as 60'
+	total := math.Round(v*60*1e6) / 1e6
+	deg := math.Floor(total / 60)
+	minutes := total - deg*60
+	return fmt.Sprintf("%0*d%09.6f", digits, int(deg), minutes), hemi
+}
+
+// packetUTC returns the packet's device time in UTC, from DeviceTime or
+// else the Time of day on a zero date
+func packetUTC(p Packet) (time.Time, bool) {
+	if !p.DeviceTime.IsZero() {
+		return p.DeviceTime.UTC(), true
+	}
+	t, err := time.Parse("15:04:05", p.Time)
+	return t, err == nil
+}
+
+// encodeUBX writes a NAV-DOP message followed by the NAV-PVT that
+// completes the packet in the UBX decoder
+func encodeUBX(p Packet) []byte {
+	le := binary.LittleEndian
+
+	dop := make([]byte, ubxNavDOPLen)
+	le.PutUint16(dop[6:], uint16(math.Round(p.PDOP*100)))
+	le.PutUint16(dop[12:], uint16(math.Round(p.HDOP*100)))
+
+	pvt := make([]byte, ubxNavPVTLen)
+	if !p.DeviceTime.IsZero() {
+		t := p.DeviceTime.UTC()
+		le.PutUint16(pvt[4:], uint16(t.Year()))
+		pvt[6], pvt[7] = byte(t.Month()), byte(t.Day())
+		pvt[8], pvt[9], pvt[10] = byte(t.Hour()), byte(t.Minute()), byte(t.Second())
+		pvt[11] = 0x03 // validDate, validTime
+		le.PutUint32(pvt[16:], uint32(int32(t.Nanosecond())))
+	}
+	switch p.Fix {
+	case Fix2D:
+		pvt[20] = 2
+	case Fix3D:
+		pvt[20] = 3
+	}
+	if p.Fix != FixNone {
+		pvt[21] = 0x01 // gnssFixOK
+	}
+	pvt[23] = byte(min(max(p.Satellites, 0), math.MaxUint8))
+	le.PutUint32(pvt[24:], uint32(int32(math.Round(p.Longitude*1e7))))
+	le.PutUint32(pvt[28:], uint32(int32(math.Round(p.Latitude*1e7))))
+	le.PutUint32(pvt[36:], uint32(int32(math.Round(p.Altitude*1000))))
+	le.PutUint32(pvt[60:], uint32(int32(math.Round(p.Speed/0.0036))))
+	le.PutUint32(pvt[64:], uint32(int32(math.Round(p.Course*1e5))))
+	le.PutUint16(pvt[76:], uint16(math.Round(p.PDOP*100)))
+
+	out := appendUBXFrame(nil, ubxClassNAV, ubxIDNavDOP, dop)
+	return appendUBXFrame(out, ubxClassNAV, ubxIDNavPVT, pvt)
+}
+
+// appendUBXFrame adds sync characters, header and checksum to a payload
+func appendUBXFrame(dst []byte, class, id byte, payload []byte) []byte {
+	start := len(dst)
+	dst = append(dst, ubxSync1, ubxSync2, class, id)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(payload)))
+	dst = append(dst, payload...)
+	a, b := ubxChecksum(dst[start+2:])
+	return append(dst, a, b)
+}
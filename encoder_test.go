@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const roundTrips = 2000
+
+func newRand(t testing.TB) *rand.Rand {
+	t.Helper()
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed %d", seed)
+	return rand.New(rand.NewPCG(seed, 0))
+}
+
+func randomString(r *rand.Rand, alphabet string, minLen, maxLen int) string {
+	b := make([]byte, minLen+r.IntN(maxLen-minLen+1))
+	for i := range b {
+		b[i] = alphabet[r.IntN(len(alphabet))]
+	}
+	return string(b)
+}
+
+const alnum = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomFloat returns values of varied magnitude and precision
+func randomFloat(r *rand.Rand, limit float64) float64 {
+	v := (r.Float64()*2 - 1) * limit
+	if r.IntN(2) == 0 {
+		v = math.Round(v*1000) / 1000
+	}
+	return v
+}
+
+func randomClock(r *rand.Rand) string {
+	t := time.Time{}.Add(time.Duration(r.IntN(86400000)) * time.Millisecond)
+	if r.IntN(2) == 0 {
+		return t.Format("15:04:05")
+	}
+	return t.Format("15:04:05.000")
+}
+
+// randomTextPacket returns a packet the text format carries exactly
+func randomTextPacket(r *rand.Rand) Packet {
+	p := Packet{
+		DeviceID:     randomString(r, alnum+"_-", 1, 12),
+		Time:         randomClock(r),
+		Latitude:     randomFloat(r, 90),
+		Longitude:    randomFloat(r, 180),
+		Satellites:   r.IntN(65),
+		Acceleration: [3]float64{randomFloat(r, 16), randomFloat(r, 16), randomFloat(r, 16)},
+		Checksum:     []ChecksumStatus{ChecksumNone, ChecksumXOR, ChecksumCRC16}[r.IntN(3)],
+	}
+	if r.IntN(2) == 0 {
+		p.Seq, p.HasSeq = r.Uint32(), true
+	}
+	for _, name := range []string{"Altitude", "Speed", "Course", "HDOP", "PDOP"} {
+		if r.IntN(2) == 0 {
+			p.setGNSS(name, randomFloat(r, 1000))
+		}
+	}
+	if r.IntN(2) == 0 {
+		p.Fix = FixType(r.IntN(3))
+		p.GNSS |= HasFix
+	}
+	if r.IntN(2) == 0 {
+		p.Gyro = [3]float64{randomFloat(r, 2000), randomFloat(r, 2000), randomFloat(r, 2000)}
+		p.IMU |= HasGyro
+	}
+	if r.IntN(2) == 0 {
+		p.Magnetometer = [3]float64{randomFloat(r, 100), randomFloat(r, 100), randomFloat(r, 100)}
+		p.IMU |= HasMagnetometer
+	}
+	if r.IntN(2) == 0 {
+		p.Temperature = randomFloat(r, 100)
+		p.IMU |= HasTemperature
+	}
+	for range r.IntN(3) {
+		// Lower case names cannot collide with the schema prefixes
+		p.setExtra(randomString(r, "abcdefghijklmnopqrstuvwxyz", 1, 8), randomString(r, alnum+".,", 0, 10))
+	}
+	return p
+}
+
+func TestEncodeTextRoundTrip(t *testing.T) {
+	r := newRand(t)
+	for range roundTrips {
+		want := randomTextPacket(r)
+		line, err := EncodePacket(ProtocolText, want)
+		if err != nil {
+			t.Fatalf("EncodePacket(%+v): %v", want, err)
+		}
+		got, err := ParsePacket(string(line))
+		if err != nil {
+			t.Fatalf("ParsePacket(%q): %v", line, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip of %q\n got %+v\nwant %+v", line, got, want)
+		}
+	}
+}
+
+// randomBinaryPacket returns a packet whose values are exact multiples of
+// the binary format's resolution
+func randomBinaryPacket(r *rand.Rand) Packet {
+	i16 := func(scale float64) float64 { return float64(int16(r.Uint32())) / scale }
+	p := Packet{
+		DeviceID:     randomString(r, alnum, 1, binMaxIDLen),
+		Seq:          r.Uint32(),
+		HasSeq:       true,
+		Time:         time.Time{}.Add(time.Duration(r.IntN(86400000)) * time.Millisecond).Format("15:04:05.000"),
+		Latitude:     float64(int32(r.IntN(1800000001)-900000000)) * 1e-7,
+		Longitude:    float64(int32(r.IntN(3600000001)-1800000000)) * 1e-7,
+		Satellites:   r.IntN(256),
+		Fix:          FixType(r.IntN(3)),
+		Acceleration: [3]float64{i16(1000), i16(1000), i16(1000)},
+		Checksum:     ChecksumCRC16,
+	}
+	for bit, f := range binGNSSFlags {
+		if r.IntN(2) == 0 {
+			continue
+		}
+		p.GNSS |= f
+		u16 := float64(r.IntN(math.MaxUint16+1)) / 100
+		switch bit {
+		case 0:
+			p.Altitude = float64(int32(r.Uint32())) / 1000
+		case 1:
+			p.Speed = u16
+		case 2:
+			p.Course = u16
+		case 3:
+			p.HDOP = u16
+		case 4:
+			p.PDOP = u16
+		}
+	}
+	if r.IntN(2) == 0 {
+		p.Gyro = [3]float64{i16(10), i16(10), i16(10)}
+		p.IMU |= HasGyro
+	}
+	if r.IntN(2) == 0 {
+		p.Magnetometer = [3]float64{i16(10), i16(10), i16(10)}
+		p.IMU |= HasMagnetometer
+	}
+	if r.IntN(2) == 0 {
+		p.Temperature = i16(100)
+		p.IMU |= HasTemperature
+	}
+	return p
+}
+
+func TestEncodeBinaryRoundTrip(t *testing.T) {
+	r := newRand(t)
+	for range roundTrips {
+		want := randomBinaryPacket(r)
+		frame, err := EncodePacket(ProtocolBinary, want)
+		if err != nil {
+			t.Fatalf("EncodePacket(%+v): %v", want, err)
+		}
+		if i := bytes.IndexByte(frame, 0); i != len(frame)-1 {
+			t.Fatalf("delimiter at %d in a %d byte frame", i, len(frame))
+		}
+		got, err := DecodeBinaryPacket(frame[:len(frame)-1])
+		if err != nil {
+			t.Fatalf("DecodeBinaryPacket(% X): %v", frame, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip\n got %+v\nwant %+v", got, want)
+		}
+	}
+}
+
+// randomGNSSPacket returns a fix as a receiver reports it. NMEA dates
+// have two year digits, read as 1969-2068
+func randomGNSSPacket(r *rand.Rand) Packet {
+	p := Packet{
+		DeviceTime: time.Date(2000+r.IntN(68), time.January, 1, 0, 0, 0, 0, time.UTC).
+			Add(time.Duration(r.Int64N(int64(365*24*time.Hour))) / time.Millisecond * time.Millisecond),
+		Latitude:   (r.Float64()*2 - 1) * 89,
+		Longitude:  (r.Float64()*2 - 1) * 179,
+		Satellites: r.IntN(100),
+		Fix:        FixType(1 + r.IntN(2)),
+		GNSS:       HasFix,
+	}
+	for _, name := range []string{"Altitude", "Speed", "Course", "HDOP", "PDOP"} {
+		if r.IntN(4) == 0 {
+			continue
+		}
+		switch name {
+		case "Altitude":
+			p.setGNSS(name, (r.Float64()*2-1)*1000)
+		case "Speed":
+			p.setGNSS(name, r.Float64()*300)
+		case "Course":
+			p.setGNSS(name, r.Float64()*360)
+		default:
+			p.setGNSS(name, r.Float64()*50)
+		}
+	}
+	p.Time = p.DeviceTime.Format("15:04:05.000")
+	return p
+}
+
+// decodeLast decodes a stream and returns the packet completed by its
+// last sentence or message; a fresh NMEA decoder also completes one on
+// the RMC before it has seen a GGA
+func decodeLast(proto Protocol, data []byte) (Packet, error) {
+	dec := NewDecoder(proto, bytes.NewReader(data))
+	var last SourceEvent
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Packet{}, err
+		}
+		if ev.Err != nil {
+			return Packet{}, ev.Err
+		}
+		last = ev
+	}
+	if last.Fragment || last.Raw == "" {
+		return Packet{}, errors.New("no complete packet at the end of the stream")
+	}
+	return last.Packet, nil
+}
+
+// tolerance is the largest error of each field in a wire format
+type tolerance struct {
+	position, altitude, speed, course, dop float64
+}
+
+// compareGNSS checks the fields a receiver protocol carries
+func compareGNSS(got, want Packet, tol tolerance) error {
+	var errs []string
+	near := func(name string, got, want, tol float64) {
+		if math.Abs(got-want) > tol {
+			errs = append(errs, fmt.Sprintf("%s %v, want %v ± %v", name, got, want, tol))
+		}
+	}
+
+	if !got.DeviceTime.Equal(want.DeviceTime) || got.Time != want.Time {
+		errs = append(errs, fmt.Sprintf("time %v (%s), want %v (%s)", got.DeviceTime, got.Time, want.DeviceTime, want.Time))
+	}
+	near("Latitude", got.Latitude, want.Latitude, tol.position)
+	near("Longitude", got.Longitude, want.Longitude, tol.position)
+	if got.Satellites != want.Satellites {
+		errs = append(errs, fmt.Sprintf("Satellites %d, want %d", got.Satellites, want.Satellites))
+	}
+	if got.Fix != want.Fix {
+		errs = append(errs, fmt.Sprintf("Fix %v, want %v", got.Fix, want.Fix))
+	}
+	for _, f := range []struct {
+		name      string
+		flag      GNSSFields
+		got, want float64
+		tol       float64
+	}{
+		{"Altitude", HasAltitude, got.Altitude, want.Altitude, tol.altitude},
+		{"Speed", HasSpeed, got.Speed, want.Speed, tol.speed},
+		{"Course", HasCourse, got.Course, want.Course, tol.course},
+		{"HDOP", HasHDOP, got.HDOP, want.HDOP, tol.dop},
+		{"PDOP", HasPDOP, got.PDOP, want.PDOP, tol.dop},
+	} {
+		if !want.GNSS.Has(f.flag) {
+			continue
+		}
+		if !got.GNSS.Has(f.flag) {
+			errs = append(errs, f.name+" missing")
+			continue
+		}
+		near(f.name, f.got, f.want, f.tol)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func TestEncodeNMEARoundTrip(t *testing.T) {
+	r := newRand(t)
+	tol := tolerance{
+		position: 0.5e-6 / 60, // 6 decimals of minutes
+		altitude: 0.05,
+		speed:    0.0005*knotsToKmh + 1e-9,
+		course:   0.005,
+		dop:      0.005,
+	}
+	for range roundTrips {
+		want := randomGNSSPacket(r)
+		data, err := EncodePacket(ProtocolNMEA, want)
+		if err != nil {
+			t.Fatalf("EncodePacket(%+v): %v", want, err)
+		}
+		got, err := decodeLast(ProtocolNMEA, data)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", data, err)
+		}
+		if err := compareGNSS(got, want, tol); err != nil {
+			t.Fatalf("round trip of %q: %v", data, err)
+		}
+	}
+}
+
+func TestEncodeUBXRoundTrip(t *testing.T) {
+	r := newRand(t)
+	tol := tolerance{
+		position: 0.5e-7,
+		altitude: 0.0005,
+		speed:    0.0018 + 1e-9, // mm/s
+		course:   0.5e-5,
+		dop:      0.005,
+	}
+	for range roundTrips {
+		want := randomGNSSPacket(r)
+		data, err := EncodePacket(ProtocolUBX, want)
+		if err != nil {
+			t.Fatalf("EncodePacket(%+v): %v", want, err)
+		}
+		got, err := decodeLast(ProtocolUBX, data)
+		if err != nil {
+			t.Fatalf("decoding % X: %v", data, err)
+		}
+		if err := compareGNSS(got, want, tol); err != nil {
+			t.Fatalf("round trip of %+v: %v", want, err)
+		}
+	}
+}
+
+// The binary time of day is on the device clock, whatever the host zone
+func TestEncodeBinaryDeviceTime(t *testing.T) {
+	r := newRand(t)
+	for range roundTrips {
+		want := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC).
+			Add(time.Duration(r.Int64N(int64(365*24*time.Hour))) / time.Millisecond * time.Millisecond)
+		// The hour repeated when DST ends is ambiguous on a wall clock
+		local := want.In(deviceLocation)
+		if !time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(),
+			local.Nanosecond(), deviceLocation).Equal(want) {
+			continue
+		}
+
+		p := randomBinaryPacket(r)
+		p.DeviceTime = want.In(time.FixedZone("host", r.IntN(24*3600)-12*3600))
+
+		frame, err := EncodePacket(ProtocolBinary, p)
+		if err != nil {
+			t.Fatalf("EncodePacket(%+v): %v", p, err)
+		}
+		got, err := DecodeBinaryPacket(frame[:len(frame)-1])
+		if err != nil {
+			t.Fatalf("DecodeBinaryPacket(% X): %v", frame, err)
+		}
+		stampPacket(&got, want)
+		if !got.DeviceTime.Equal(want) {
+			t.Fatalf("device time %v (%s), want %v", got.DeviceTime, got.Time, want)
+		}
+	}
+}
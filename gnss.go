@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FixType is the dimension of the receiver's position solution
+type FixType uint8
+
+const (
+	FixNone FixType = iota
+	Fix2D
+	Fix3D
+)
+
+func (f FixType) String() string {
+	switch f {
+	case Fix2D:
+		return "2D"
+	case Fix3D:
+		return "3D"
+	default:
+		return "NONE"
+	}
+}
+
+// ParseFixType accepts "NONE", "2D" and "3D" as well as the NMEA GSA mode
+// digits 1 (no fix), 2 and 3
+func ParseFixType(s string) (FixType, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "NONE", "NO", "1", "0":
+		return FixNone, nil
+	case "2D", "2":
+		return Fix2D, nil
+	case "3D", "3":
+		return Fix3D, nil
+	default:
+		return FixNone, fmt.Errorf("unknown fix type %q", s)
+	}
+}
+
+// GNSSFields records which optional GNSS fields a packet carried, so that
+// a missing value is not mistaken for zero
+type GNSSFields uint8
+
+const (
+	HasAltitude GNSSFields = 1 << iota
+	HasSpeed
+	HasCourse
+	HasHDOP
+	HasPDOP
+	HasFix
+)
+
+// Has reports whether all the given fields are present
+func (g GNSSFields) Has(f GNSSFields) bool {
+	return g&f == f
+}
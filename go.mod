@@ -6,6 +6,7 @@ require (
 	gioui.org v0.9.0
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	golang.org/x/sys v0.37.0
 )
 
 require (
@@ -13,6 +14,5 @@ require (
 	github.com/go-text/typesetting v0.3.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20251023183803-a4bb9ffd2546 // indirect
 	golang.org/x/image v0.32.0 // indirect
-	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 )
@@ -0,0 +1,16 @@
+package main
+
+// IMUFields records which optional inertial sensor channels a packet
+// carried; boards before the IMU revision only send Acceleration
+type IMUFields uint8
+
+const (
+	HasGyro IMUFields = 1 << iota
+	HasMagnetometer
+	HasTemperature
+)
+
+// Has reports whether all the given fields are present
+func (f IMUFields) Has(fields IMUFields) bool {
+	return f&fields == fields
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"gioui.org/app"
@@ -18,19 +21,28 @@ import (
 	"gioui.org/unit"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
-
-	"github.com/tarm/serial"
 )
 
 type UIState struct {
-	LastPacket Packet
-	Series     []float32
-	LogLines   []string
+	LastPacket  Packet
+	Recent      []Packet // last seriesCapacity packets for the graph
+	ChannelList widget.Enum
+	LogLines    []string
 
-	AvailablePorts []string
+	AvailablePorts []PortInfo
+	SimPort        string // pseudo-terminal of the built-in simulator
 	PortList       widget.Enum
 	BaudList       widget.Enum
+	DataBitsList   widget.Enum
+	ParityList     widget.Enum
+	StopBitsList   widget.Enum
+	TimeoutList    widget.Enum
+	ProtocolList   widget.Enum
+	SettingsPort   string // port whose saved settings are shown
 	OpenBtn        widget.Clickable
+	ReopenBtn      widget.Clickable
+	DetectBtn      widget.Clickable
+	Detecting      bool
 	ClearBtn       widget.Clickable
 
 	// Database test buttons
@@ -45,9 +57,27 @@ type UIState struct {
 	DBConnected   bool
 	DBPacketCount int
 	DBSeries      []float32
+	DBSeriesTime  []time.Time
 	DBLastPacket  *StoredPacket
-
-	PortOpen bool
+	DBWriter      *DBWriter // nil without a database
+
+	PortState      ConnState
+	SourceName     string
+	ChecksumErrors int
+	Rejected       int // packets dropped by strict validation
+	Suspect        int // packets kept but flagged by lenient validation
+	Sequences      *SequenceTracker
+
+	// Log area tabs and command console
+	LogTab  widget.Enum
+	Console *Console
+	Monitor *RawMonitor
+
+	// Session recording and replay
+	RecordBtn widget.Clickable
+	StepBtn   widget.Clickable
+	Recording bool
+	Replay    *ReplaySource
 }
 
 const (
@@ -55,7 +85,51 @@ const (
 	logCapacity    = 200
 )
 
+const (
+	tabLog     = "Žurnalas"
+	tabConsole = "Konsolė"
+	tabMonitor = "Monitorius"
+)
+
+var logTabs = []string{tabLog, tabConsole, tabMonitor}
+
+var (
+	sourceFlag = flag.String("source", "",
+		"read from a non-serial source: tcp://host:port, udp://[host]:port, file://path,\n"+
+			"replay://session.log[?speed=N|?step] or stdin")
+	simulateFlag = flag.Bool("simulate", false, "start a simulated device on a pseudo-terminal and open it")
+	simRateFlag  = flag.Float64("sim-rate", 10, "simulated packets per second")
+	simSumFlag   = flag.String("sim-checksum", "none", "checksum appended by the simulator: none, xor or crc16")
+	simFmtFlag   = flag.String("sim-format", "text", "wire format sent by the simulator: text, nmea, ubx or binary")
+	simTrackFlag = flag.String("sim-track", "", "file with latitude,longitude waypoints for the simulator")
+	commandsFlag = flag.String("commands", "STATUS,RESET,RATE 1,RATE 10", "comma separated predefined console commands")
+	validateFlag = flag.String("validation", "lenient", "packets outside the limits are kept as suspect (lenient) or rejected (strict)")
+	limitsFlag   = flag.String("limits", "", "JSON file overriding the validation limits per field")
+	schemaFlag   = flag.String("schema", "", "JSON file declaring additional packet fields")
+	dbQueueFlag  = flag.Int("db-queue", 10000, "packets buffered for the database writer")
+	dbBatchFlag  = flag.Int("db-batch", 200, "packets written per database transaction")
+	dbFlushFlag  = flag.Duration("db-flush", 500*time.Millisecond, "longest a packet waits before a partial batch is written")
+	dbPolicyFlag = flag.String("db-policy", "block", "when the database queue is full: block, drop-oldest or drop-newest")
+	protocolFlag = flag.String("protocol", "text", "wire protocol of the -source stream: text, nmea, ubx or binary")
+)
+
 func main() {
+	flag.Parse()
+
+	limits, err := LoadValidationLimits(*limitsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if packetValidator, err = NewValidator(*validateFlag, limits); err != nil {
+		log.Fatal(err)
+	}
+	if fieldSchema, err = LoadFieldSchema(*schemaFlag); err != nil {
+		log.Fatal(err)
+	}
+	if dbWriterConfig, err = NewDBWriterConfig(*dbQueueFlag, *dbBatchFlag, *dbFlushFlag, *dbPolicyFlag); err != nil {
+		log.Fatal(err)
+	}
+
 	go runApp()
 	app.Main()
 }
@@ -69,18 +143,24 @@ func runApp() {
 
 	th := material.NewTheme()
 	var state UIState
-
-	state.AvailablePorts = []string{
-		"COM40 - STMicroelect",
-		"COM12 - USB-SERIAL",
-		"/dev/tty.usbserial-0001",
-	}
-	state.PortList.Value = state.AvailablePorts[0]
+	state.Console = NewConsole(ParsePresets(*commandsFlag))
+	state.Monitor = NewRawMonitor()
+	state.Sequences = NewSequenceTracker()
+	state.LogTab.Value = logTabs[0]
+	state.ChannelList.Value = graphChannels[0].Name
 
 	baudRates := []string{"115200", "921600", "460800", "9600"}
-	state.BaudList.Value = baudRates[0]
+	state.applySettings(DefaultSerialSettings())
 
-	packets := make(chan Packet, 128)
+	settingsStore, err := LoadSettingsStore(getSettingsPath())
+	if err != nil {
+		log.Printf("Failed to load serial settings: %v", err)
+	}
+
+	sourceEvents := make(chan SourceEvent, 128)
+	portUpdates := make(chan []PortInfo, 1)
+	connEvents := make(chan ConnEvent, 16)
+	detectEvents := make(chan DetectEvent, 16)
 
 	// Initialize database connection
 	dsn := getDatabaseDSN()
@@ -91,15 +171,51 @@ func runApp() {
 	} else {
 		state.DBConnected = true
 		log.Println("Database connected successfully")
-		defer db.Close()
 	}
 
-	go startSerialReader(
-		w,
-		packets,
-		&state,
-		db,
-	)
+	// Packets are spooled to disk while the database is unreachable
+	spool, err := OpenSpool(getSpoolPath())
+	if err != nil {
+		log.Printf("Failed to open spool, packets will be lost while the database is down: %v", err)
+	}
+
+	go watchPorts(w, portUpdates)
+
+	recorder := &Recorder{}
+	defer recorder.Stop()
+
+	writer := NewDBWriter(db, dsn, spool, dbWriterConfig, w.Invalidate)
+	defer writer.Close()
+	state.DBWriter = writer
+
+	sourceMgr := NewSourceManager(w, sourceEvents, connEvents, writer, recorder)
+	defer sourceMgr.Close()
+
+	if *simulateFlag {
+		if stop, err := startSimulatorPort(&state); err != nil {
+			state.addLog(fmt.Sprintf("[ERROR] Failed to start simulator: %v", err))
+		} else {
+			defer stop()
+			openSelectedPort(&state, sourceMgr, settingsStore)
+		}
+	}
+
+	if *sourceFlag != "" {
+		src, err := ParseSourceSpec(*sourceFlag)
+		var proto Protocol
+		if err == nil {
+			proto, err = ParseProtocol(*protocolFlag)
+		}
+		if err == nil {
+			err = sourceMgr.Start(WithProtocol(src, proto))
+		}
+		if replay, ok := src.(*ReplaySource); ok && err == nil {
+			state.Replay = replay
+		}
+		if err != nil {
+			state.addLog(fmt.Sprintf("[ERROR] Failed to start source: %v", err))
+		}
+	}
 
 	for {
 		e := w.Event()
@@ -116,42 +232,154 @@ func runApp() {
 			var ops op.Ops
 			gtx := app.NewContext(&ops, ev)
 
+			// The writer reconnects in the background
+			state.DBConnected = writer.Stats().Connected
+			db = writer.Database()
+
 		drain:
 			for {
 				select {
-				case p := <-packets:
+				case ev := <-sourceEvents:
+					state.Monitor.Add(ev)
+					if errors.Is(ev.Err, ErrChecksum) {
+						state.ChecksumErrors++
+					}
+					if errors.Is(ev.Err, ErrOutOfLimits) {
+						state.Rejected++
+					}
+					if ev.Err != nil {
+						if ev.Response {
+							state.Console.AddLine("< " + strings.TrimRight(ev.Raw, "\r\n\x00"))
+						} else {
+							log.Println("parse error:", ev.Err)
+						}
+						continue
+					}
+					if ev.Fragment {
+						continue
+					}
+					p := ev.Packet
 					state.LastPacket = p
+					state.Sequences.Observe(p)
+					if p.Suspect {
+						state.Suspect++
+					}
 
-					v := float32(p.Acceleration[2])
-					state.Series = append(state.Series, v)
-					if len(state.Series) > seriesCapacity {
-						state.Series = state.Series[len(state.Series)-seriesCapacity:]
+					state.Recent = append(state.Recent, p)
+					if len(state.Recent) > seriesCapacity {
+						state.Recent = state.Recent[len(state.Recent)-seriesCapacity:]
 					}
 
 					line := fmt.Sprintf("%s Lat:%.6f Lon:%.6f Sat:%d AccZ:%.2f",
 						p.Time, p.Latitude, p.Longitude, p.Satellites, p.Acceleration[2])
+					if len(p.Extra) > 0 {
+						line += " " + formatExtra(p.Extra, fieldSchema)
+					}
 					state.LogLines = append(state.LogLines, line)
 					if len(state.LogLines) > logCapacity {
 						state.LogLines = state.LogLines[len(state.LogLines)-logCapacity:]
 					}
 
+				case ports := <-portUpdates:
+					state.updatePorts(ports)
+
+				case ev := <-connEvents:
+					state.PortState = ev.State
+					state.SourceName = ev.Source
+					if ev.Message != "" {
+						state.addLog(ev.Message)
+					}
+
+				case ev := <-detectEvents:
+					if ev.Message != "" {
+						state.addLog(ev.Message)
+					}
+					if ev.Done {
+						state.Detecting = false
+						if ev.Err != nil {
+							state.addLog(fmt.Sprintf("[ERROR] Auto-detect failed: %v", ev.Err))
+						} else {
+							state.addLog(fmt.Sprintf("[DETECT] Selected %s (%d/%d lines parsed)",
+								ev.Result.Settings, ev.Result.Parsed, ev.Result.Lines))
+							state.applySettings(ev.Result.Settings)
+							openSelectedPort(&state, sourceMgr, settingsStore)
+						}
+					}
+
 				default:
 					break drain
 				}
 			}
 
+			// Show the saved settings of the newly selected device
+			if state.PortList.Value != state.SettingsPort {
+				state.SettingsPort = state.PortList.Value
+				if p, ok := FindPort(state.AvailablePorts, state.PortList.Value); ok {
+					state.applySettings(settingsStore.Get(p))
+				}
+			}
+
 			if state.OpenBtn.Clicked(gtx) {
-				state.PortOpen = true
-				state.LogLines = append(state.LogLines,
-					"[INFO] COM PORT opened: "+state.PortList.Value+
-						" @ "+state.BaudList.Value+" baud")
-				if len(state.LogLines) > logCapacity {
-					state.LogLines = state.LogLines[len(state.LogLines)-logCapacity:]
+				if sourceMgr.IsOpen() {
+					if err := sourceMgr.Close(); err != nil {
+						state.addLog(fmt.Sprintf("[ERROR] %v", err))
+					} else {
+						state.addLog("[INFO] COM PORT closed")
+					}
+				} else {
+					openSelectedPort(&state, sourceMgr, settingsStore)
+				}
+			}
+			if state.DetectBtn.Clicked(gtx) && !state.Detecting {
+				sourceMgr.Close()
+				state.Detecting = true
+				state.addLog("[DETECT] Probing " + state.PortList.Value + "...")
+				startDetect(w, state.PortList.Value, state.serialSettings(), detectEvents)
+			}
+			if state.ReopenBtn.Clicked(gtx) {
+				if err := sourceMgr.Reopen(); err != nil {
+					state.addLog(fmt.Sprintf("[ERROR] Failed to reopen COM PORT: %v", err))
+				} else {
+					state.addLog("[INFO] COM PORT reopened")
+				}
+			}
+			state.Monitor.Update(gtx)
+			sourceMgr.ShowRaw(state.LogTab.Value == tabMonitor && !state.Monitor.Paused)
+
+			if cmd, ok := state.Console.Update(gtx); ok {
+				if err := sourceMgr.Send([]byte(cmd + state.Console.Terminator())); err != nil {
+					state.Console.AddLine(fmt.Sprintf("! %v", err))
+				} else {
+					state.Console.AddLine("> " + cmd)
+				}
+			}
+
+			if state.RecordBtn.Clicked(gtx) {
+				if recorder.Active() {
+					n, err := recorder.Stop()
+					if err != nil {
+						state.addLog(fmt.Sprintf("[ERROR] %v", err))
+					}
+					state.addLog(fmt.Sprintf("[RECORD] Session stopped, %d lines recorded", n))
+				} else {
+					filename := GenerateSessionFilename()
+					if err := recorder.Start(filename, sourceMgr.Protocol()); err != nil {
+						state.addLog(fmt.Sprintf("[ERROR] %v", err))
+					} else {
+						state.addLog("[RECORD] Recording session to: " + filename)
+					}
 				}
+				state.Recording = recorder.Active()
+			}
+			if state.StepBtn.Clicked(gtx) && state.Replay != nil {
+				state.Replay.Step()
 			}
 			if state.ClearBtn.Clicked(gtx) {
 				state.LogLines = nil
-				state.Series = nil
+				state.Recent = nil
+				state.Sequences.Reset()
+				state.Rejected = 0
+				state.Suspect = 0
 			}
 
 			// Database test button handlers
@@ -204,19 +432,24 @@ func runApp() {
 					state.DBPacketCount = 0
 					state.DBLastPacket = nil
 					state.DBSeries = nil
+					state.DBSeriesTime = nil
 				}
 				if len(state.LogLines) > logCapacity {
 					state.LogLines = state.LogLines[len(state.LogLines)-logCapacity:]
 				}
 			}
 
-			if state.LoadFromDBBtn.Clicked(gtx) && state.DBConnected && db != nil {
-				series, err := db.GetAccelerationSeries(seriesCapacity)
+			// Switching channels reloads a graph showing database data
+			channelChanged := state.ChannelList.Update(gtx) && len(state.DBSeries) > 0
+			if (state.LoadFromDBBtn.Clicked(gtx) || channelChanged) && state.DBConnected && db != nil {
+				channel := findGraphChannel(state.ChannelList.Value)
+				series, times, err := db.GetChannelSeries(channel, seriesCapacity)
 				if err != nil {
 					state.LogLines = append(state.LogLines, fmt.Sprintf("[ERROR] Failed to load series from DB: %v", err))
 				} else {
 					state.DBSeries = series
-					state.LogLines = append(state.LogLines, fmt.Sprintf("[DB] Loaded %d data points for visualization", len(series)))
+					state.DBSeriesTime = times
+					state.LogLines = append(state.LogLines, fmt.Sprintf("[DB] Loaded %d %s data points for visualization", len(series), channel.Name))
 				}
 				if len(state.LogLines) > logCapacity {
 					state.LogLines = state.LogLines[len(state.LogLines)-logCapacity:]
@@ -256,61 +489,116 @@ func runApp() {
 	}
 }
 
-func startSerialReader(w *app.Window, out chan Packet, state *UIState, db *Database) {
+// updatePorts replaces the list of available ports, logs hot-plug changes
+// and keeps the current selection valid
+func (s *UIState) updatePorts(ports []PortInfo) {
+	if s.SimPort != "" {
+		if _, ok := FindPort(ports, s.SimPort); !ok {
+			ports = append(ports, PortInfo{Path: s.SimPort, Product: "Simulator"})
+		}
+	}
 
-	baud, _ := strconv.Atoi(state.BaudList.Value)
+	for _, p := range ports {
+		if _, ok := FindPort(s.AvailablePorts, p.Path); !ok {
+			s.addLog("[PORT] Device connected: " + p.Label())
+		}
+	}
+	for _, p := range s.AvailablePorts {
+		if _, ok := FindPort(ports, p.Path); !ok {
+			s.addLog("[PORT] Device removed: " + p.Label())
+		}
+	}
+	s.AvailablePorts = ports
 
-	cfg := &serial.Config{
-		Name:        "/dev/tty.usbserial-0001",
-		Baud:        baud,
-		Size:        8,
-		Parity:      serial.ParityOdd,
-		StopBits:    serial.Stop1,
-		ReadTimeout: time.Millisecond * 500,
+	if _, ok := FindPort(ports, s.PortList.Value); !ok {
+		s.PortList.Value = ""
+		if len(ports) > 0 {
+			s.PortList.Value = ports[0].Path
+		}
 	}
+}
 
-	port, err := serial.OpenPort(cfg)
+// startSimulatorPort starts the device simulator configured on the command
+// line and selects its pseudo-terminal in the port list
+func startSimulatorPort(state *UIState) (func(), error) {
+	cfg := DefaultSimulatorConfig()
+	cfg.Rate = *simRateFlag
+	cfg.Checksum = ChecksumStatus(*simSumFlag)
+	switch cfg.Checksum {
+	case ChecksumNone, ChecksumXOR, ChecksumCRC16:
+	default:
+		return nil, fmt.Errorf("unknown checksum %q", *simSumFlag)
+	}
+	format, err := ParseProtocol(*simFmtFlag)
 	if err != nil {
-		log.Println("cannot open port:", err)
-		return
+		return nil, err
 	}
-	defer port.Close()
-
-	reader := bufio.NewReader(port)
-
-	for {
-		line, err := reader.ReadString('\n')
+	cfg.Format = format
+	if *simTrackFlag != "" {
+		track, err := LoadTrack(*simTrackFlag)
 		if err != nil {
-			log.Println("read error:", err)
-			continue
+			return nil, err
 		}
+		cfg.Track = track
+	}
 
-		p, err := ParsePacket(line)
-		if err != nil {
-			log.Println("parse error:", err)
-			continue
-		}
+	path, stop, err := StartSimulator(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-		select {
-		case out <- p:
-		default:
-			select {
-			case <-out:
-			default:
-			}
-			out <- p
-		}
+	state.SimPort = path
+	state.updatePorts(state.AvailablePorts)
+	state.PortList.Value = path
+	state.ProtocolList.Value = string(format)
+	state.addLog("[SIM] Simulated device running on " + path)
+	return stop, nil
+}
 
-		// Auto-save to database if connected
-		if db != nil {
-			go func() {
-				if _, err := db.InsertPacket(p); err != nil {
-					log.Printf("Failed to auto-save packet to database: %v", err)
-				}
-			}()
+// openSelectedPort opens the selected port with the settings chosen in the
+// UI and remembers them for that device
+func openSelectedPort(state *UIState, mgr *SourceManager, store *SettingsStore) {
+	settings := state.serialSettings()
+	if err := mgr.Open(state.PortList.Value, settings); err != nil {
+		state.addLog(fmt.Sprintf("[ERROR] Failed to open COM PORT: %v", err))
+		return
+	}
+
+	state.addLog("[INFO] COM PORT opened: " + state.PortList.Value + " @ " + settings.String())
+	if p, ok := FindPort(state.AvailablePorts, state.PortList.Value); ok {
+		if err := store.Set(p, settings); err != nil {
+			state.addLog(fmt.Sprintf("[ERROR] Failed to save port settings: %v", err))
 		}
+	}
+}
 
-		w.Invalidate()
+// serialSettings builds port settings from the current UI selection
+func (s *UIState) serialSettings() SerialSettings {
+	cfg := DefaultSerialSettings()
+	cfg.Baud, _ = strconv.Atoi(s.BaudList.Value)
+	cfg.DataBits, _ = strconv.Atoi(s.DataBitsList.Value)
+	cfg.Parity = s.ParityList.Value
+	cfg.StopBits = s.StopBitsList.Value
+	cfg.ReadTimeoutMs, _ = strconv.Atoi(s.TimeoutList.Value)
+	cfg.Protocol = s.ProtocolList.Value
+	return cfg
+}
+
+// applySettings selects the given port settings in the UI
+func (s *UIState) applySettings(cfg SerialSettings) {
+	s.BaudList.Value = strconv.Itoa(cfg.Baud)
+	s.DataBitsList.Value = strconv.Itoa(cfg.DataBits)
+	s.ParityList.Value = cfg.Parity
+	s.StopBitsList.Value = cfg.StopBits
+	s.TimeoutList.Value = strconv.Itoa(cfg.ReadTimeoutMs)
+	s.ProtocolList.Value = string(cfg.WireProtocol())
+}
+
+// addLog appends a line to the log panel, keeping at most logCapacity lines
+func (s *UIState) addLog(line string) {
+	s.LogLines = append(s.LogLines, line)
+	if len(s.LogLines) > logCapacity {
+		s.LogLines = s.LogLines[len(s.LogLines)-logCapacity:]
 	}
 }
 
@@ -322,8 +610,8 @@ func layoutRoot(gtx layout.Context, th *material.Theme, st *UIState, baudRates [
 			border := widgetBorder(gtx, color.NRGBA{R: 180, G: 0, B: 0, A: 255})
 			return border(func(gtx layout.Context) layout.Dimensions {
 				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
-					layout.Flexed(0.25, func(gtx layout.Context) layout.Dimensions {
-						return sectionPortHeader(gtx, th)
+					layout.Flexed(0.2, func(gtx layout.Context) layout.Dimensions {
+						return sectionPortHeader(gtx, th, st)
 					}),
 					layout.Flexed(0.2, func(gtx layout.Context) layout.Dimensions {
 						return sectionGPSHeader(gtx, th, st)
@@ -331,10 +619,13 @@ func layoutRoot(gtx layout.Context, th *material.Theme, st *UIState, baudRates [
 					layout.Flexed(0.15, func(gtx layout.Context) layout.Dimensions {
 						return sectionTimeHeader(gtx, th, st)
 					}),
-					layout.Flexed(0.15, func(gtx layout.Context) layout.Dimensions {
+					layout.Flexed(0.1, func(gtx layout.Context) layout.Dimensions {
 						return sectionSatsHeader(gtx, th, st)
 					}),
-					layout.Flexed(0.25, func(gtx layout.Context) layout.Dimensions {
+					layout.Flexed(0.15, func(gtx layout.Context) layout.Dimensions {
+						return sectionDeviceHeader(gtx, th, st)
+					}),
+					layout.Flexed(0.2, func(gtx layout.Context) layout.Dimensions {
 						return sectionDBHeader(gtx, th, st)
 					}),
 				)
@@ -362,19 +653,77 @@ func layoutRoot(gtx layout.Context, th *material.Theme, st *UIState, baudRates [
 	)
 }
 
-func sectionPortHeader(gtx layout.Context, th *material.Theme) layout.Dimensions {
+func sectionPortHeader(gtx layout.Context, th *material.Theme, st *UIState) layout.Dimensions {
 
 	return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
-		return material.Body1(th, "COM PORT Valdymas").Layout(gtx)
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return material.Body1(th, "COM PORT Valdymas").Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				txt := st.PortState.String()
+				if st.PortState != StateDisconnected {
+					txt += ": " + st.SourceName
+				}
+				lbl := material.Body2(th, txt)
+				switch st.PortState {
+				case StateConnected:
+					lbl.Color = color.NRGBA{R: 56, G: 142, B: 60, A: 255}
+				case StateReconnecting:
+					lbl.Color = color.NRGBA{R: 245, G: 124, B: 0, A: 255}
+				}
+				return lbl.Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if st.ChecksumErrors == 0 {
+					return layout.Dimensions{}
+				}
+				return material.Caption(th, fmt.Sprintf("Checksum klaidos: %d", st.ChecksumErrors)).Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if st.Rejected == 0 && st.Suspect == 0 {
+					return layout.Dimensions{}
+				}
+				txt := fmt.Sprintf("Atmesta: %d, įtartini: %d (%s)", st.Rejected, st.Suspect, packetValidator.Mode)
+				return material.Caption(th, txt).Layout(gtx)
+			}),
+		)
 	})
 }
 
+// gnssSummary lists the optional GNSS fields the last packet reported
+func gnssSummary(p Packet) string {
+	var parts []string
+	if p.GNSS.Has(HasFix) {
+		parts = append(parts, "Fix "+p.Fix.String())
+	}
+	if p.GNSS.Has(HasAltitude) {
+		parts = append(parts, fmt.Sprintf("%.1f m", p.Altitude))
+	}
+	if p.GNSS.Has(HasSpeed) {
+		parts = append(parts, fmt.Sprintf("%.1f km/h", p.Speed))
+	}
+	if p.GNSS.Has(HasCourse) {
+		parts = append(parts, fmt.Sprintf("%.0f°", p.Course))
+	}
+	if p.GNSS.Has(HasHDOP) {
+		parts = append(parts, fmt.Sprintf("HDOP %.1f", p.HDOP))
+	}
+	if p.GNSS.Has(HasPDOP) {
+		parts = append(parts, fmt.Sprintf("PDOP %.1f", p.PDOP))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func sectionGPSHeader(gtx layout.Context, th *material.Theme, st *UIState) layout.Dimensions {
 	txt := fmt.Sprintf("GPS Koordinatės:\n%.6f, %.6f",
 		st.LastPacket.Latitude, st.LastPacket.Longitude)
 	if st.LastPacket.Latitude == 0 && st.LastPacket.Longitude == 0 {
 		txt = "GPS Koordinatės:\n-----"
 	}
+	if fix := gnssSummary(st.LastPacket); fix != "" {
+		txt += "\n" + fix
+	}
 	return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return material.Body2(th, txt).Layout(gtx)
 	})
@@ -382,10 +731,13 @@ func sectionGPSHeader(gtx layout.Context, th *material.Theme, st *UIState) layou
 
 func sectionTimeHeader(gtx layout.Context, th *material.Theme, st *UIState) layout.Dimensions {
 	timeTxt := st.LastPacket.Time
+	if t := st.LastPacket.DeviceTime; !t.IsZero() {
+		timeTxt = t.In(deviceLocation).Format("2006-01-02 15:04:05.000 MST")
+	}
 	if timeTxt == "" {
 		timeTxt = "-----"
 	}
-	txt := "EET Laikas:\n" + timeTxt
+	txt := "Įrenginio laikas:\n" + timeTxt
 	return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return material.Body2(th, txt).Layout(gtx)
 	})
@@ -402,6 +754,26 @@ func sectionSatsHeader(gtx layout.Context, th *material.Theme, st *UIState) layo
 	})
 }
 
+func sectionDeviceHeader(gtx layout.Context, th *material.Theme, st *UIState) layout.Dimensions {
+	device := st.LastPacket.DeviceID
+	if device == "" {
+		device = "-----"
+	}
+	txt := "Įrenginys: " + device
+	// One gap counter line per device, named when there are several
+	stats := st.Sequences.Stats()
+	for _, s := range stats {
+		txt += "\n"
+		if len(stats) > 1 {
+			txt += s.DeviceID + ": "
+		}
+		txt += fmt.Sprintf("Trūksta: %d, dubl.: %d, sukeista: %d", s.Lost, s.Duplicates, s.Reordered)
+	}
+	return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return material.Body2(th, txt).Layout(gtx)
+	})
+}
+
 func leftPanel(gtx layout.Context, th *material.Theme, st *UIState, baudRates []string) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 
@@ -417,6 +789,12 @@ func leftPanel(gtx layout.Context, th *material.Theme, st *UIState, baudRates []
 			})
 		}),
 
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return enumPicker(gtx, th, &st.LogTab, logTabs)
+			})
+		}),
+
 		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 			return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 
@@ -425,6 +803,12 @@ func leftPanel(gtx layout.Context, th *material.Theme, st *UIState, baudRates []
 
 				inset := layout.UniformInset(unit.Dp(8))
 				return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					switch st.LogTab.Value {
+					case tabConsole:
+						return consolePanel(gtx, th, st.Console)
+					case tabMonitor:
+						return monitorPanel(gtx, th, st.Monitor)
+					}
 
 					children := make([]layout.FlexChild, 0, len(st.LogLines))
 					for i := len(st.LogLines) - 1; i >= 0; i-- {
@@ -453,7 +837,15 @@ func comControls(gtx layout.Context, th *material.Theme, st *UIState, baudRates
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			return labeledRow(gtx, th, "PORT pasirinkimas:", st.PortList.Value)
+			selected := "-----"
+			if p, ok := FindPort(st.AvailablePorts, st.PortList.Value); ok {
+				selected = filepath.Base(p.Path)
+			}
+			return labeledRow(gtx, th, "PORT pasirinkimas:", selected)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return portPicker(gtx, th, st)
 		}),
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -461,8 +853,120 @@ func comControls(gtx layout.Context, th *material.Theme, st *UIState, baudRates
 		}),
 
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			btn := material.Button(th, &st.OpenBtn, "Atidaryti COM PORT")
-			return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, btn.Layout)
+			return enumPicker(gtx, th, &st.BaudList, baudRates)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Duomenų bitai:", &st.DataBitsList, dataBitsOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Lyginumas:", &st.ParityList, parityOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Stop bitai:", &st.StopBitsList, stopBitsOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Laukimo laikas (ms):", &st.TimeoutList, readTimeoutOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return settingsRow(gtx, th, "Protokolas:", &st.ProtocolList, protocolOptions)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := "Atidaryti COM PORT"
+			if st.PortState != StateDisconnected {
+				label = "Uždaryti COM PORT"
+			}
+			return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return material.Button(th, &st.OpenBtn, label).Layout(gtx)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							return material.Button(th, &st.ReopenBtn, "Atidaryti iš naujo").Layout(gtx)
+						})
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						label := "Auto-nustatymas"
+						if st.Detecting {
+							label = "Tikrinama..."
+						}
+						return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							return material.Button(th, &st.DetectBtn, label).Layout(gtx)
+						})
+					}),
+				)
+			})
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := "Įrašyti sesiją"
+			if st.Recording {
+				label = "Stabdyti įrašymą"
+			}
+			return layout.Inset{Top: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(th, &st.RecordBtn, label)
+						if st.Recording {
+							btn.Background = color.NRGBA{R: 244, G: 67, B: 54, A: 255}
+						}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if st.Replay == nil || !st.Replay.Stepping {
+							return layout.Dimensions{}
+						}
+						return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							return material.Button(th, &st.StepBtn, "Kitas žingsnis").Layout(gtx)
+						})
+					}),
+				)
+			})
+		}),
+	)
+}
+
+func portPicker(gtx layout.Context, th *material.Theme, st *UIState) layout.Dimensions {
+	if len(st.AvailablePorts) == 0 {
+		return material.Body2(th, "Prievadų nerasta").Layout(gtx)
+	}
+
+	children := make([]layout.FlexChild, 0, len(st.AvailablePorts))
+	for _, p := range st.AvailablePorts {
+		port := p
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(th, &st.PortList, port.Path, port.Label()).Layout(gtx)
+		}))
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
+
+func enumPicker(gtx layout.Context, th *material.Theme, enum *widget.Enum, options []string) layout.Dimensions {
+	children := make([]layout.FlexChild, 0, len(options))
+	for _, o := range options {
+		opt := o
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(th, enum, opt, opt).Layout(gtx)
+		}))
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+}
+
+func settingsRow(gtx layout.Context, th *material.Theme, label string, enum *widget.Enum, options []string) layout.Dimensions {
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return material.Body2(th, label).Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return enumPicker(gtx, th, enum, options)
 		}),
 	)
 }
@@ -500,6 +1004,17 @@ func rightPanel(gtx layout.Context, th *material.Theme, st *UIState) layout.Dime
 			})
 		}),
 
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			channel := findGraphChannel(st.ChannelList.Value)
+			label := "Kanalas:"
+			if u := channel.Unit(); u != "" {
+				label = fmt.Sprintf("Kanalas (%s):", u)
+			}
+			return layout.Inset{Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return settingsRow(gtx, th, label, &st.ChannelList, graphChannelNames())
+			})
+		}),
+
 		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 			inset := layout.UniformInset(unit.Dp(16))
 			return inset.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
@@ -517,18 +1032,20 @@ func rightPanel(gtx layout.Context, th *material.Theme, st *UIState) layout.Dime
 				gtx.Constraints = c
 
 				// Choose which series to display
-				series := st.Series
+				series, times := channelSeries(st.Recent, findGraphChannel(st.ChannelList.Value))
 				if len(st.DBSeries) > 0 {
-					series = st.DBSeries
+					series, times = st.DBSeries, st.DBSeriesTime
 				}
 
-				return drawGraph(gtx, series, wPx, hPx)
+				return drawGraph(gtx, series, times, wPx, hPx)
 			})
 		}),
 	)
 }
 
-func drawGraph(gtx layout.Context, series []float32, width, height int) layout.Dimensions {
+// drawGraph plots series against time when every point has a timestamp,
+// otherwise evenly spaced by index
+func drawGraph(gtx layout.Context, series []float32, times []time.Time, width, height int) layout.Dimensions {
 
 	paint.FillShape(
 		gtx.Ops,
@@ -607,8 +1124,14 @@ func drawGraph(gtx layout.Context, series []float32, width, height int) layout.D
 	sig.Begin(gtx.Ops)
 
 	n := len(series)
+	xAt := func(i int) float32 { return float32(i) / float32(n-1) }
+	if len(times) == n && !times[0].IsZero() {
+		if span := times[n-1].Sub(times[0]); span > 0 {
+			xAt = func(i int) float32 { return float32(times[i].Sub(times[0])) / float32(span) }
+		}
+	}
 	for i := 0; i < n; i++ {
-		xn := float32(i) / float32(n-1)
+		xn := xAt(i)
 		x := leftPad + xn*plotW
 
 		vnorm := (series[i] - minV) / (maxV - minV)
@@ -638,6 +1161,16 @@ func sectionDBHeader(gtx layout.Context, th *material.Theme, st *UIState) layout
 	if st.DBConnected {
 		status = fmt.Sprintf("Connected (%d packets)", st.DBPacketCount)
 	}
+	if st.DBWriter != nil {
+		ws := st.DBWriter.Stats()
+		status += fmt.Sprintf("\nQueue: %d/%d, dropped: %d, failed: %d", ws.Queued, ws.Capacity, ws.Dropped, ws.Failed)
+		if ws.Spooled > 0 || ws.SpoolSize > 0 {
+			status += fmt.Sprintf("\nSpool: %d packets (%.1f KB)", ws.Spooled, float64(ws.SpoolSize)/1024)
+		}
+		if ws.LastErr != nil {
+			status += "\n[ERROR] " + ws.LastErr.Error()
+		}
+	}
 	txt := "Database:\n" + status
 	return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return material.Body2(th, txt).Layout(gtx)
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN checksum_status VARCHAR(8) NOT NULL DEFAULT 'none' AFTER acceleration_z;
+
+-- +goose Down
+ALTER TABLE packets
+    DROP COLUMN checksum_status;
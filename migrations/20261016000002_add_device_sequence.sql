@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN device_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id,
+    ADD COLUMN sequence BIGINT NULL AFTER device_id,
+    ADD INDEX idx_device_sequence (device_id, sequence);
+
+-- +goose Down
+ALTER TABLE packets
+    DROP INDEX idx_device_sequence,
+    DROP COLUMN sequence,
+    DROP COLUMN device_id;
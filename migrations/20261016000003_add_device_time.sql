@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN device_time DATETIME(3) NULL AFTER time,
+    ADD COLUMN received_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) AFTER device_time,
+    ADD INDEX idx_received_at (received_at),
+    ADD INDEX idx_device_time (device_time);
+
+-- Rows stored before this migration only know their insert time, which
+-- reads in the session zone; received_at is kept in UTC
+UPDATE packets SET received_at = CONVERT_TZ(created_at, @@session.time_zone, '+00:00');
+
+-- +goose Down
+ALTER TABLE packets
+    DROP INDEX idx_device_time,
+    DROP INDEX idx_received_at,
+    DROP COLUMN received_at,
+    DROP COLUMN device_time;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN suspect TINYINT(1) NOT NULL DEFAULT 0 AFTER checksum_status;
+
+-- +goose Down
+ALTER TABLE packets
+    DROP COLUMN suspect;
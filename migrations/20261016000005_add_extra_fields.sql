@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN extra JSON NULL AFTER suspect;
+
+-- +goose Down
+ALTER TABLE packets
+    DROP COLUMN extra;
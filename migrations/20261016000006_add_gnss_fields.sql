@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN altitude DOUBLE NULL AFTER satellites,
+    ADD COLUMN speed DOUBLE NULL AFTER altitude,
+    ADD COLUMN course DOUBLE NULL AFTER speed,
+    ADD COLUMN hdop DOUBLE NULL AFTER course,
+    ADD COLUMN pdop DOUBLE NULL AFTER hdop,
+    ADD COLUMN fix_type VARCHAR(4) NULL AFTER pdop;
+
+-- +goose Down
+ALTER TABLE packets
+    DROP COLUMN fix_type,
+    DROP COLUMN pdop,
+    DROP COLUMN hdop,
+    DROP COLUMN course,
+    DROP COLUMN speed,
+    DROP COLUMN altitude;
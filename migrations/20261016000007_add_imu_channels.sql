@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE packets
+    ADD COLUMN gyro_x DOUBLE NULL AFTER acceleration_z,
+    ADD COLUMN gyro_y DOUBLE NULL AFTER gyro_x,
+    ADD COLUMN gyro_z DOUBLE NULL AFTER gyro_y,
+    ADD COLUMN mag_x DOUBLE NULL AFTER gyro_z,
+    ADD COLUMN mag_y DOUBLE NULL AFTER mag_x,
+    ADD COLUMN mag_z DOUBLE NULL AFTER mag_y,
+    ADD COLUMN temperature DOUBLE NULL AFTER mag_z;
+
+-- +goose Down
+ALTER TABLE packets
+    DROP COLUMN temperature,
+    DROP COLUMN mag_z,
+    DROP COLUMN mag_y,
+    DROP COLUMN mag_x,
+    DROP COLUMN gyro_z,
+    DROP COLUMN gyro_y,
+    DROP COLUMN gyro_x;
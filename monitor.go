@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const (
+	monitorCapacity = 500
+	monitorFont     = "Go Mono, monospace"
+)
+
+// RawMonitor keeps the most recent raw lines from the active source for
+// the hex/ASCII view, including the ones that failed to parse
+type RawMonitor struct {
+	Entries []SourceEvent
+	Frozen  []SourceEvent // snapshot shown while paused
+	Paused  bool
+	Errors  *ParseErrorStats
+
+	PauseBtn widget.Clickable
+	ClearBtn widget.Clickable
+	Search   widget.Editor
+}
+
+// NewRawMonitor creates an empty monitor
+func NewRawMonitor() *RawMonitor {
+	m := &RawMonitor{Errors: NewParseErrorStats()}
+	m.Search.SingleLine = true
+	return m
+}
+
+// Add stores a received line, keeping at most monitorCapacity entries.
+// Valid lines received while the monitor was hidden carry no raw text and
+// are skipped
+func (m *RawMonitor) Add(ev SourceEvent) {
+	if ev.Err != nil {
+		m.Errors.Add(ev.Err)
+	}
+	if ev.Raw == "" && ev.Err == nil {
+		return
+	}
+	m.Entries = append(m.Entries, ev)
+	if len(m.Entries) > monitorCapacity {
+		m.Entries = m.Entries[len(m.Entries)-monitorCapacity:]
+	}
+}
+
+// Update handles the pause and clear buttons
+func (m *RawMonitor) Update(gtx layout.Context) {
+	if m.PauseBtn.Clicked(gtx) {
+		m.Paused = !m.Paused
+		if m.Paused {
+			m.Frozen = append([]SourceEvent(nil), m.Entries...)
+		} else {
+			m.Frozen = nil
+		}
+	}
+	if m.ClearBtn.Clicked(gtx) {
+		m.Entries = nil
+		m.Frozen = nil
+		m.Errors.Reset()
+	}
+}
+
+// visible returns the entries to show, newest first, filtered by the
+// search text which matches the ASCII or hex form case-insensitively
+func (m *RawMonitor) visible() []SourceEvent {
+	entries := m.Entries
+	if m.Paused {
+		entries = m.Frozen
+	}
+	query := strings.ToLower(strings.TrimSpace(m.Search.Text()))
+
+	out := make([]SourceEvent, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		ev := entries[i]
+		if query != "" &&
+			!strings.Contains(strings.ToLower(ev.Raw), query) &&
+			!strings.Contains(hexDump(ev.Raw), query) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// hexDump formats bytes as space separated lowercase hex
+func hexDump(raw string) string {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x", raw[i])
+	}
+	return b.String()
+}
+
+// printable replaces control and non-ASCII bytes with dots
+func printable(raw string) string {
+	b := []byte(raw)
+	for i, c := range b {
+		if c < 0x20 || c > 0x7e {
+			b[i] = '.'
+		}
+	}
+	return string(b)
+}
+
+func monitorPanel(gtx layout.Context, th *material.Theme, m *RawMonitor) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := "Pristabdyti"
+			if m.Paused {
+				label = "Tęsti"
+			}
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return material.Editor(th, &m.Search, "Paieška (tekstas arba hex)...").Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, material.Button(th, &m.PauseBtn, label).Layout)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, material.Button(th, &m.ClearBtn, "Išvalyti").Layout)
+				}),
+			)
+		}),
+
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			txt := fmt.Sprintf("Eilučių: %d, klaidingų: %d", len(m.Entries), m.Errors.Total)
+			if summary := m.Errors.Summary(); summary != "" {
+				txt += " (" + summary + ")"
+			}
+			return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, material.Caption(th, txt).Layout)
+		}),
+
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			entries := m.visible()
+			children := make([]layout.FlexChild, 0, len(entries))
+			for _, e := range entries {
+				ev := e
+				children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return monitorEntry(gtx, th, ev)
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		}),
+	)
+}
+
+func monitorEntry(gtx layout.Context, th *material.Theme, ev SourceEvent) layout.Dimensions {
+	mono := func(txt string) material.LabelStyle {
+		lbl := material.Caption(th, txt)
+		lbl.Font = font.Font{Typeface: monitorFont}
+		if ev.Err != nil {
+			lbl.Color = color.NRGBA{R: 198, G: 40, B: 40, A: 255}
+		}
+		return lbl
+	}
+
+	return layout.Inset{Bottom: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return mono(ev.Time.Format("15:04:05.000") + "  " + printable(ev.Raw)).Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return mono("              " + hexDump(ev.Raw)).Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if ev.Err == nil {
+					return layout.Dimensions{}
+				}
+				return mono(errorMarker(ev)).Layout(gtx)
+			}),
+		)
+	})
+}
+
+// errorMarker points at the failing field under the ASCII line; errors
+// without a position are explained at the start of the line
+func errorMarker(ev SourceEvent) string {
+	const indent = "              " // width of the timestamp column
+	var pe *ParseError
+	if errors.As(ev.Err, &pe) && pe.Field != "" && pe.Offset >= 0 && pe.Offset <= len(ev.Raw) {
+		return indent + strings.Repeat(" ", pe.Offset) + "^ " + pe.Error()
+	}
+	return fmt.Sprintf("%s^ %v", indent, ev.Err)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const knotsToKmh = 1.852
+
+var (
+	errNotNMEA      = errors.New("not an NMEA sentence")
+	errNMEAChecksum = errors.New("NMEA sentences need a *HH XOR checksum")
+)
+
+// NMEAAssembler merges NMEA 0183 sentences into packets. GGA carries the
+// fix, so a packet is completed by every GGA, with speed, course, date,
+// DOP and fix type taken from the latest RMC, VTG, GSA and GSV; receivers
+// that send no GGA complete a packet with every RMC instead
+type NMEAAssembler struct {
+	state  Packet
+	date   time.Time // UTC date and time of the last RMC
+	sawGGA bool
+	sawGSA bool
+}
+
+// NewNMEAAssembler creates an assembler with no sentences seen yet
+func NewNMEAAssembler() *NMEAAssembler {
+	return &NMEAAssembler{}
+}
+
+// nmeaSentence is a checksum verified sentence split into fields
+type nmeaSentence struct {
+	line    string
+	talker  string // GP, GN, GL, ...
+	kind    string // GGA, RMC, ...
+	fields  []string
+	offsets []int // offset of each field in line
+}
+
+// field returns the i-th data field (after the address), or "" if absent
+func (s *nmeaSentence) field(i int) string {
+	if i+1 >= len(s.fields) {
+		return ""
+	}
+	return s.fields[i+1]
+}
+
+// position names the i-th data field ("GGA.2") and finds its offset
+func (s *nmeaSentence) position(i int) (string, int) {
+	at := len(s.line)
+	if i+1 < len(s.offsets) {
+		at = s.offsets[i+1]
+	}
+	return s.kind + "." + strconv.Itoa(i+1), at
+}
+
+func (s *nmeaSentence) errorAt(i int, kind ParseErrorKind, err error) error {
+	name, at := s.position(i)
+	return &ParseError{Kind: kind, Field: name, Value: s.field(i), Offset: at, Line: s.line, Err: err}
+}
+
+// float parses an optional numeric field; ok is false when it is empty
+func (s *nmeaSentence) float(i int) (v float64, ok bool, err error) {
+	raw := s.field(i)
+	if raw == "" {
+		return 0, false, nil
+	}
+	v, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		name, at := s.position(i)
+		return 0, false, numberError(s.line, name, raw, at, err)
+	}
+	return v, true, nil
+}
+
+// coordinate parses a ddmm.mmmm / dddmm.mmmm field and its hemisphere
+func (s *nmeaSentence) coordinate(i int, negative string) (float64, bool, error) {
+	v, ok, err := s.float(i)
+	if !ok || err != nil {
+		return 0, false, err
+	}
+	deg := float64(int(v / 100))
+	deg += (v - deg*100) / 60
+	switch s.field(i + 1) {
+	case negative:
+		deg = -deg
+	case "N", "E":
+	default:
+		return 0, false, s.errorAt(i+1, ParseFormat, fmt.Errorf("bad hemisphere"))
+	}
+	return deg, true, nil
+}
+
+// parseNMEA verifies and splits a sentence
+func parseNMEA(line string) (*nmeaSentence, ChecksumStatus, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, ChecksumNone, &ParseError{Kind: ParseEmpty, Line: line}
+	}
+	if line[0] != '$' {
+		return nil, ChecksumNone, &ParseError{Kind: ParseFormat, Line: line, Err: errNotNMEA}
+	}
+
+	body, sum, err := splitChecksum(line)
+	if err != nil {
+		return nil, sum, err
+	}
+	if sum != ChecksumXOR {
+		// NMEA 0183 has no unchecked or CRC-16 sentences
+		trailer := line[len(body):]
+		return nil, sum, &ParseError{Kind: ParseChecksum, Field: "Checksum", Value: strings.TrimPrefix(trailer, "*"),
+			Offset: len(body) + min(len(trailer), 1), Line: line, Err: errNMEAChecksum}
+	}
+
+	s := &nmeaSentence{line: line, fields: strings.Split(body[1:], ",")}
+	at := 1
+	for _, f := range s.fields {
+		s.offsets = append(s.offsets, at)
+		at += len(f) + 1
+	}
+
+	addr := s.fields[0]
+	if len(addr) != 5 {
+		return nil, sum, &ParseError{Kind: ParseFormat, Field: "address", Value: addr, Offset: 1, Line: line, Err: errNotNMEA}
+	}
+	s.talker, s.kind = addr[:2], addr[2:]
+	return s, sum, nil
+}
+
+// Feed processes one sentence; complete reports whether it finished a
+// packet, which is then returned
+func (a *NMEAAssembler) Feed(line string, received time.Time) (Packet, bool, error) {
+	s, sum, err := parseNMEA(line)
+	if err != nil {
+		return Packet{}, false, err
+	}
+
+	anchor := false
+	switch s.kind {
+	case "GGA":
+		err = a.gga(s)
+		a.sawGGA = true
+		anchor = true
+	case "RMC":
+		err = a.rmc(s)
+		anchor = !a.sawGGA
+	case "VTG":
+		err = a.vtg(s)
+	case "GSA":
+		err = a.gsa(s)
+	case "GSV":
+		err = a.gsv(s)
+	}
+	if err != nil || !anchor {
+		return Packet{}, false, err
+	}
+
+	p := a.state
+	p.DeviceID = "NMEA-" + s.talker
+	p.Checksum = sum
+	p.Extra = maps.Clone(a.state.Extra)
+	p.DeviceTime = a.deviceTime(p.Time, received)
+	return p, true, nil
+}
+
+// deviceTime combines the UTC clock with the RMC date, or the receive
+// date when no RMC has been seen
+func (a *NMEAAssembler) deviceTime(clock string, received time.Time) time.Time {
+	if clock == "" {
+		return time.Time{}
+	}
+	t, err := ParseDeviceTime(clock, received, time.UTC)
+	if err != nil {
+		return time.Time{}
+	}
+	if !a.date.IsZero() {
+		t = time.Date(a.date.Year(), a.date.Month(), a.date.Day(),
+			t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		// A GGA just after midnight may arrive before the next RMC
+		if a.date.Sub(t) > 12*time.Hour {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+// setClock converts an hhmmss.ss field into the packet's Time
+func (a *NMEAAssembler) setClock(s *nmeaSentence, i int) error {
+	raw := s.field(i)
+	if raw == "" {
+		return nil
+	}
+	t, err := time.Parse("150405.999999999", raw)
+	if err != nil {
+		return s.errorAt(i, ParseFormat, err)
+	}
+	a.state.Time = t.Format("15:04:05.000")
+	return nil
+}
+
+func (a *NMEAAssembler) setPosition(s *nmeaSentence, i int) error {
+	lat, okLat, err := s.coordinate(i, "S")
+	if err != nil {
+		return err
+	}
+	lon, okLon, err := s.coordinate(i+2, "W")
+	if err != nil {
+		return err
+	}
+	if okLat && okLon {
+		a.state.Latitude, a.state.Longitude = lat, lon
+	} else {
+		// No fix: report zero coordinates like the board does
+		a.state.Latitude, a.state.Longitude = 0, 0
+	}
+	return nil
+}
+
+// gga: time, lat, N/S, lon, E/W, quality, satellites, HDOP, altitude, M, ...
+func (a *NMEAAssembler) gga(s *nmeaSentence) error {
+	if err := a.setClock(s, 0); err != nil {
+		return err
+	}
+	if err := a.setPosition(s, 1); err != nil {
+		return err
+	}
+
+	quality, ok, err := s.float(5)
+	if err != nil {
+		return err
+	}
+	if ok {
+		a.setExtra("FixQuality", int64(quality))
+		// GSA reports 2D/3D precisely; without it any fix counts as 3D
+		// since GGA carries an altitude
+		if quality == 0 {
+			a.state.Fix = FixNone
+			a.state.GNSS |= HasFix
+		} else if !a.sawGSA {
+			a.state.Fix = Fix3D
+			a.state.GNSS |= HasFix
+		}
+	}
+
+	sats, _, err := s.float(6)
+	if err != nil {
+		return err
+	}
+	a.state.Satellites = int(sats)
+
+	if err := a.setOptional(s, 7, HasHDOP, &a.state.HDOP, 1); err != nil {
+		return err
+	}
+	return a.setOptional(s, 8, HasAltitude, &a.state.Altitude, 1)
+}
+
+// rmc: time, status, lat, N/S, lon, E/W, speed (knots), course, date, ...
+func (a *NMEAAssembler) rmc(s *nmeaSentence) error {
+	if err := a.setClock(s, 0); err != nil {
+		return err
+	}
+	if !a.sawGGA {
+		if s.field(1) == "A" {
+			if err := a.setPosition(s, 2); err != nil {
+				return err
+			}
+		} else {
+			a.state.Latitude, a.state.Longitude = 0, 0
+		}
+	}
+	if err := a.setOptional(s, 6, HasSpeed, &a.state.Speed, knotsToKmh); err != nil {
+		return err
+	}
+	if err := a.setOptional(s, 7, HasCourse, &a.state.Course, 1); err != nil {
+		return err
+	}
+
+	if raw := s.field(8); raw != "" {
+		date, err := time.Parse("020106", raw)
+		if err != nil {
+			return s.errorAt(8, ParseFormat, err)
+		}
+		if clock, err := time.Parse("150405.999999999", s.field(0)); err == nil {
+			date = time.Date(date.Year(), date.Month(), date.Day(),
+				clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), time.UTC)
+		}
+		a.date = date
+	}
+	return nil
+}
+
+// vtg: course (true), T, course (magnetic), M, speed (knots), N, speed (km/h), K
+func (a *NMEAAssembler) vtg(s *nmeaSentence) error {
+	if err := a.setOptional(s, 0, HasCourse, &a.state.Course, 1); err != nil {
+		return err
+	}
+	if s.field(6) != "" {
+		return a.setOptional(s, 6, HasSpeed, &a.state.Speed, 1)
+	}
+	return a.setOptional(s, 4, HasSpeed, &a.state.Speed, knotsToKmh)
+}
+
+// gsa: mode, fix type (1 none, 2 2D, 3 3D), 12 PRNs, PDOP, HDOP, VDOP
+func (a *NMEAAssembler) gsa(s *nmeaSentence) error {
+	if raw := s.field(1); raw != "" {
+		fix, err := ParseFixType(raw)
+		if err != nil {
+			return s.errorAt(1, ParseOutOfRange, err)
+		}
+		a.state.Fix = fix
+		a.state.GNSS |= HasFix
+		a.sawGSA = true
+	}
+	if err := a.setOptional(s, 14, HasPDOP, &a.state.PDOP, 1); err != nil {
+		return err
+	}
+	return a.setOptional(s, 15, HasHDOP, &a.state.HDOP, 1)
+}
+
+// gsv: message count, message number, satellites in view, satellite blocks
+func (a *NMEAAssembler) gsv(s *nmeaSentence) error {
+	v, ok, err := s.float(2)
+	if err != nil {
+		return err
+	}
+	if ok {
+		// Each constellation sends its own GSV set
+		a.setExtra("SatellitesInView"+s.talker, int64(v))
+	}
+	return nil
+}
+
+// setOptional stores the i-th field, scaled by factor, in dst and marks it
+// present in the state. Receivers send the field empty once they lose the
+// fix, which clears it so that no stale value is reported as current
+func (a *NMEAAssembler) setOptional(s *nmeaSentence, i int, flag GNSSFields, dst *float64, factor float64) error {
+	v, ok, err := s.float(i)
+	if err != nil {
+		return err
+	}
+	if ok {
+		*dst = v * factor
+		a.state.GNSS |= flag
+	} else {
+		*dst = 0
+		a.state.GNSS &^= flag
+	}
+	return nil
+}
+
+func (a *NMEAAssembler) setExtra(name string, value any) {
+	if a.state.Extra == nil {
+		a.state.Extra = make(map[string]any)
+	}
+	a.state.Extra[name] = value
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// feedNMEA feeds sentences to a, adding their checksums, and returns the
+// last packet completed
+func feedNMEA(t *testing.T, a *NMEAAssembler, sentences ...string) (Packet, bool) {
+	t.Helper()
+	received := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	var last Packet
+	completed := false
+	for _, s := range sentences {
+		p, complete, err := a.Feed(AppendChecksum(s, ChecksumXOR)+"\r\n", received)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if complete {
+			last, completed = p, true
+		}
+	}
+	return last, completed
+}
+
+func TestNMEALostFixClearsState(t *testing.T) {
+	fix := []string{
+		"$GPRMC,120000.00,A,5441.2320,N,02516.7820,E,5.0,271.0,161026,,,A",
+		"$GPGSA,A,3,01,02,03,04,05,06,07,08,09,,,,1.4,0.9,1.1",
+		"$GPGGA,120000.00,5441.2320,N,02516.7820,E,1,09,0.9,112.5,M,28.0,M,,",
+	}
+	noFixGGA := "$GPGGA,120001.00,,,,,0,00,,,M,,M,,"
+
+	t.Run("GGA", func(t *testing.T) {
+		a := NewNMEAAssembler()
+		p, _ := feedNMEA(t, a, fix...)
+		all := HasFix | HasHDOP | HasPDOP | HasAltitude | HasSpeed | HasCourse
+		if p.GNSS != all || p.Satellites != 9 || p.Latitude == 0 {
+			t.Fatalf("fix packet %+v", p)
+		}
+
+		p, ok := feedNMEA(t, a, noFixGGA)
+		if !ok {
+			t.Fatal("no packet from the no-fix GGA")
+		}
+		if p.GNSS.Has(HasHDOP) || p.GNSS.Has(HasAltitude) || p.HDOP != 0 || p.Altitude != 0 {
+			t.Errorf("stale GGA fields: %+v", p)
+		}
+		if p.Fix != FixNone || p.Satellites != 0 || p.Latitude != 0 || p.Longitude != 0 {
+			t.Errorf("fix not cleared: %+v", p)
+		}
+	})
+
+	t.Run("epoch", func(t *testing.T) {
+		a := NewNMEAAssembler()
+		feedNMEA(t, a, fix...)
+		p, _ := feedNMEA(t, a,
+			"$GPRMC,120001.00,V,,,,,,,161026,,,N",
+			"$GPVTG,,T,,M,,N,,K,N",
+			"$GPGSA,A,1,,,,,,,,,,,,,,,",
+			noFixGGA,
+		)
+		if p.GNSS != HasFix || p.Fix != FixNone {
+			t.Errorf("stale fields after losing the fix: %+v", p)
+		}
+		if p.Speed != 0 || p.Course != 0 || p.HDOP != 0 || p.PDOP != 0 || p.Altitude != 0 {
+			t.Errorf("stale values after losing the fix: %+v", p)
+		}
+	})
+}
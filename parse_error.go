@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ParseErrorKind groups parse failures by cause
+type ParseErrorKind int
+
+const (
+	ParseEmpty ParseErrorKind = iota
+	ParseTruncated
+	ParseBadNumber
+	ParseOutOfRange
+	ParseChecksum
+	ParseFormat
+)
+
+func (k ParseErrorKind) String() string {
+	switch k {
+	case ParseEmpty:
+		return "empty"
+	case ParseTruncated:
+		return "truncated"
+	case ParseBadNumber:
+		return "bad number"
+	case ParseOutOfRange:
+		return "out of range"
+	case ParseChecksum:
+		return "checksum"
+	case ParseFormat:
+		return "bad format"
+	default:
+		return "unknown"
+	}
+}
+
+// Label returns the kind as shown in the UI
+func (k ParseErrorKind) Label() string {
+	switch k {
+	case ParseEmpty:
+		return "tuščia"
+	case ParseTruncated:
+		return "nepilna"
+	case ParseBadNumber:
+		return "blogas skaičius"
+	case ParseOutOfRange:
+		return "už ribų"
+	case ParseChecksum:
+		return "checksum"
+	case ParseFormat:
+		return "netinkamas formatas"
+	default:
+		return "nežinoma"
+	}
+}
+
+// ParseError describes why a line could not be parsed: which field failed,
+// its raw value and where in the line it starts
+type ParseError struct {
+	Kind   ParseErrorKind
+	Field  string // field name, empty when the line as a whole is at fault
+	Value  string
+	Offset int // byte offset of Value in Line
+	Line   string
+	Err    error // underlying cause, if any
+}
+
+func (e *ParseError) Error() string {
+	msg := e.Kind.String()
+	if e.Field != "" {
+		msg += fmt.Sprintf(" in %s %q at byte %d", e.Field, e.Value, e.Offset)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// numberError classifies a strconv failure for a field value
+func numberError(line, field, value string, offset int, err error) *ParseError {
+	kind := ParseBadNumber
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		if errors.Is(numErr.Err, strconv.ErrRange) {
+			kind = ParseOutOfRange
+		}
+		err = numErr.Err
+	}
+	return &ParseError{Kind: kind, Field: field, Value: value, Offset: offset, Line: line, Err: err}
+}
+
+// ParseErrorStats counts parse failures per kind and field
+type ParseErrorStats struct {
+	Total   int
+	ByKind  map[ParseErrorKind]int
+	ByField map[string]int
+}
+
+// NewParseErrorStats creates empty statistics
+func NewParseErrorStats() *ParseErrorStats {
+	return &ParseErrorStats{
+		ByKind:  make(map[ParseErrorKind]int),
+		ByField: make(map[string]int),
+	}
+}
+
+// Add accounts for one failed line
+func (s *ParseErrorStats) Add(err error) {
+	s.Total++
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		return
+	}
+	s.ByKind[pe.Kind]++
+	if pe.Field != "" {
+		s.ByField[pe.Field]++
+	}
+}
+
+// Reset clears all counters
+func (s *ParseErrorStats) Reset() {
+	*s = *NewParseErrorStats()
+}
+
+// Summary lists the non-zero per-kind counts, e.g. "nepilna: 2, checksum: 1"
+func (s *ParseErrorStats) Summary() string {
+	kinds := make([]ParseErrorKind, 0, len(s.ByKind))
+	for k := range s.ByKind {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	txt := ""
+	for _, k := range kinds {
+		if txt != "" {
+			txt += ", "
+		}
+		txt += fmt.Sprintf("%s: %d", k.Label(), s.ByKind[k])
+	}
+	return txt
+}
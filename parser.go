@@ -2,79 +2,219 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Packet struct {
+	DeviceID     string
+	Seq          uint32
+	HasSeq       bool
 	Time         string
+	DeviceTime   time.Time // parsed Time, zero when it could not be parsed
+	ReceivedAt   time.Time
 	Latitude     float64
 	Longitude    float64
 	Satellites   int
-	Acceleration [3]float64
+	Altitude     float64 // metres above mean sea level
+	Speed        float64 // ground speed, km/h
+	Course       float64 // course over ground, degrees from true north
+	HDOP         float64
+	PDOP         float64
+	Fix          FixType
+	GNSS         GNSSFields // which of the optional GNSS fields were sent
+	Acceleration [3]float64 // g
+	Gyro         [3]float64 // °/s
+	Magnetometer [3]float64 // µT
+	Temperature  float64    // sensor die temperature, °C
+	IMU          IMUFields  // which of the optional IMU fields were sent
+	Checksum     ChecksumStatus
+	Suspect      bool           // outside validation limits but kept (lenient mode)
+	Extra        map[string]any // fields without a dedicated member, by name
 }
 
+// ParsePacket parses one telemetry line; failures are *ParseError with
+// offsets into the line as given (before trimming)
 func ParsePacket(line string) (Packet, error) {
+	trimmed := strings.TrimSpace(line)
+	lead := strings.Index(line, trimmed)
+
+	p, err := parsePacket(trimmed)
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Offset += lead
+		pe.Line = strings.TrimRight(line, "\r\n")
+	}
+	return p, err
+}
+
+func parsePacket(line string) (Packet, error) {
 	var p Packet
 
-	line = strings.TrimSpace(line)
 	if line == "" {
-		return p, errors.New("empty line")
+		return p, &ParseError{Kind: ParseEmpty, Line: line}
+	}
+
+	line, sum, err := splitChecksum(line)
+	if err != nil {
+		return p, err
 	}
+	p.Checksum = sum
 
 	parts := strings.Split(line, ";")
 	if len(parts) < 6 {
-		return p, errors.New("not enough fields")
+		return p, &ParseError{Kind: ParseTruncated, Line: line, Offset: len(line),
+			Err: fmt.Errorf("%d of 6 fields", len(parts))}
 	}
 
+	p.DeviceID = strings.TrimSpace(parts[0])
+
+	offset := len(parts[0]) + 1
 	for _, field := range parts[1:] {
-		switch {
-		case strings.HasPrefix(field, "Time-"):
-			p.Time = strings.TrimPrefix(field, "Time-")
-
-		case strings.HasPrefix(field, "Latitude-"):
-			v := strings.TrimPrefix(field, "Latitude-")
-			f, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				return p, err
-			}
-			p.Latitude = f
+		at := offset
+		offset += len(field) + 1
 
-		case strings.HasPrefix(field, "Longitude-"):
-			v := strings.TrimPrefix(field, "Longitude-")
-			f, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				return p, err
+		spec, known := fieldSchema.Match(field)
+		if !known {
+			// Keep fields the schema does not describe verbatim
+			name, v := splitUnknownField(field)
+			if _, declared := fieldSchema.Spec(name); declared {
+				return p, &ParseError{Kind: ParseTruncated, Field: name, Value: field, Offset: at, Line: line}
 			}
-			p.Longitude = f
-
-		case strings.HasPrefix(field, "Satellites-"):
-			v := strings.TrimPrefix(field, "Satellites-")
-			n, err := strconv.Atoi(v)
-			if err != nil {
-				return p, err
+			if name != "" {
+				p.setExtra(name, v)
 			}
-			p.Satellites = n
-
-		case strings.HasPrefix(field, "Acceleration"):
+			continue
+		}
 
-			partsAcc := strings.Split(field, ":")
-			if len(partsAcc) != 2 {
-				return p, errors.New("bad accel field")
-			}
-			nums := strings.Split(partsAcc[1], ",")
-			if len(nums) != 3 {
-				return p, errors.New("bad accel values")
-			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(nums[i], 64)
-				if err != nil {
-					return p, err
-				}
-				p.Acceleration[i] = f
-			}
+		v := field[len(spec.Prefix):]
+		at += len(spec.Prefix)
+		value, err := spec.Decode(v, line, at)
+		if err != nil {
+			return p, err
+		}
+		if err := p.assign(spec, value, v, line, at); err != nil {
+			return p, err
 		}
 	}
 
 	return p, nil
 }
+
+// assign stores a decoded value in its Packet member, or in Extra for
+// fields without one
+func (p *Packet) assign(spec FieldSpec, value any, raw, line string, at int) error {
+	switch spec.Name {
+	case "Seq":
+		n, ok := value.(uint64)
+		if !ok || n > math.MaxUint32 {
+			return &ParseError{Kind: ParseOutOfRange, Field: spec.Name, Value: raw, Offset: at, Line: line,
+				Err: strconv.ErrRange}
+		}
+		p.Seq = uint32(n)
+		p.HasSeq = true
+		return nil
+	case "Time":
+		if t, ok := value.(string); ok {
+			p.Time = t
+			return nil
+		}
+	case "Latitude":
+		if f, ok := value.(float64); ok {
+			p.Latitude = f
+			return nil
+		}
+	case "Longitude":
+		if f, ok := value.(float64); ok {
+			p.Longitude = f
+			return nil
+		}
+	case "Satellites":
+		if n, ok := value.(int64); ok {
+			p.Satellites = int(n)
+			return nil
+		}
+	case "Altitude", "Speed", "Course", "HDOP", "PDOP":
+		if f, ok := value.(float64); ok {
+			p.setGNSS(spec.Name, f)
+			return nil
+		}
+	case "Fix":
+		s, ok := value.(string)
+		if !ok {
+			break
+		}
+		fix, err := ParseFixType(s)
+		if err != nil {
+			return &ParseError{Kind: ParseOutOfRange, Field: spec.Name, Value: raw, Offset: at, Line: line, Err: err}
+		}
+		p.Fix = fix
+		p.GNSS |= HasFix
+		return nil
+	case "Acceleration":
+		if items, ok := value.([]any); ok && len(items) == 3 {
+			setAxes(&p.Acceleration, items)
+			return nil
+		}
+	case "Gyro":
+		if items, ok := value.([]any); ok && len(items) == 3 {
+			setAxes(&p.Gyro, items)
+			p.IMU |= HasGyro
+			return nil
+		}
+	case "Magnetometer":
+		if items, ok := value.([]any); ok && len(items) == 3 {
+			setAxes(&p.Magnetometer, items)
+			p.IMU |= HasMagnetometer
+			return nil
+		}
+	case "Temperature":
+		if f, ok := value.(float64); ok {
+			p.Temperature = f
+			p.IMU |= HasTemperature
+			return nil
+		}
+	default:
+		p.setExtra(spec.Name, value)
+		return nil
+	}
+	return fmt.Errorf("field schema: %s must keep its built-in type", spec.Name)
+}
+
+// setAxes copies a decoded 3-item float array into a vector
+func setAxes(dst *[3]float64, items []any) {
+	for i, item := range items {
+		dst[i], _ = item.(float64)
+	}
+}
+
+// setGNSS stores one of the optional floating point GNSS fields
+func (p *Packet) setGNSS(name string, f float64) {
+	switch name {
+	case "Altitude":
+		p.Altitude = f
+		p.GNSS |= HasAltitude
+	case "Speed":
+		p.Speed = f
+		p.GNSS |= HasSpeed
+	case "Course":
+		p.Course = f
+		p.GNSS |= HasCourse
+	case "HDOP":
+		p.HDOP = f
+		p.GNSS |= HasHDOP
+	case "PDOP":
+		p.PDOP = f
+		p.GNSS |= HasPDOP
+	}
+}
+
+func (p *Packet) setExtra(name string, value any) {
+	if p.Extra == nil {
+		p.Extra = make(map[string]any)
+	}
+	p.Extra[name] = value
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gioui.org/app"
+)
+
+// PortInfo describes a serial port found on the host
+type PortInfo struct {
+	Path         string // device node, e.g. /dev/ttyUSB0
+	ByID         string // stable /dev/serial/by-id link, if any
+	VID          string // USB vendor ID (hex)
+	PID          string // USB product ID (hex)
+	Manufacturer string
+	Product      string
+	SerialNumber string
+}
+
+const portScanInterval = 2 * time.Second
+
+// Label returns a human readable name for the port picker
+func (p PortInfo) Label() string {
+	name := filepath.Base(p.Path)
+	desc := p.Manufacturer
+	if p.Product != "" {
+		if desc != "" {
+			desc += " "
+		}
+		desc += p.Product
+	}
+	if desc == "" {
+		return name
+	}
+	if p.VID != "" && p.PID != "" {
+		return fmt.Sprintf("%s - %s (%s:%s)", name, desc, p.VID, p.PID)
+	}
+	return fmt.Sprintf("%s - %s", name, desc)
+}
+
+// ListPorts returns the serial ports currently present, sorted by path
+func ListPorts() ([]PortInfo, error) {
+	ports, err := scanPorts()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Path < ports[j].Path
+	})
+	return ports, nil
+}
+
+// FindPort returns the port with the given device path
+func FindPort(ports []PortInfo, path string) (PortInfo, bool) {
+	for _, p := range ports {
+		if p.Path == path {
+			return p, true
+		}
+	}
+	return PortInfo{}, false
+}
+
+// watchPorts rescans the available ports periodically and publishes the
+// list whenever a device is plugged in or removed
+func watchPorts(w *app.Window, out chan<- []PortInfo) {
+	var last []PortInfo
+	first := true
+
+	for {
+		ports, err := ListPorts()
+		if err != nil {
+			log.Println("port scan error:", err)
+		} else if first || !samePorts(last, ports) {
+			first = false
+			last = ports
+			out <- ports
+			w.Invalidate()
+		}
+		time.Sleep(portScanInterval)
+	}
+}
+
+// samePorts reports whether two port lists describe the same devices
+func samePorts(a, b []PortInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sysTTYDir  = "/sys/class/tty"
+	serialByID = "/dev/serial/by-id"
+)
+
+// scanPorts lists USB serial adapters and CDC-ACM devices using /dev and sysfs
+func scanPorts() ([]PortInfo, error) {
+	found := make(map[string]*PortInfo)
+
+	for _, pattern := range []string{"/dev/ttyUSB*", "/dev/ttyACM*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			found[m] = &PortInfo{Path: m}
+		}
+	}
+
+	// Pick up devices that only show up under by-id (e.g. renamed by udev)
+	if entries, err := os.ReadDir(serialByID); err == nil {
+		for _, e := range entries {
+			link := filepath.Join(serialByID, e.Name())
+			target, err := filepath.EvalSymlinks(link)
+			if err != nil {
+				continue
+			}
+			p, ok := found[target]
+			if !ok {
+				p = &PortInfo{Path: target}
+				found[target] = p
+			}
+			p.ByID = link
+		}
+	}
+
+	ports := make([]PortInfo, 0, len(found))
+	for _, p := range found {
+		readUSBAttributes(p)
+		ports = append(ports, *p)
+	}
+	return ports, nil
+}
+
+// readUSBAttributes fills in USB descriptor fields from sysfs, walking up
+// from the tty device to the USB device that owns it
+func readUSBAttributes(p *PortInfo) {
+	dev, err := filepath.EvalSymlinks(filepath.Join(sysTTYDir, filepath.Base(p.Path), "device"))
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < 5 && dev != "/" && dev != "."; i++ {
+		if _, err := os.Stat(filepath.Join(dev, "idVendor")); err == nil {
+			p.VID = readSysfsAttr(dev, "idVendor")
+			p.PID = readSysfsAttr(dev, "idProduct")
+			p.Manufacturer = readSysfsAttr(dev, "manufacturer")
+			p.Product = readSysfsAttr(dev, "product")
+			p.SerialNumber = readSysfsAttr(dev, "serial")
+			return
+		}
+		dev = filepath.Dir(dev)
+	}
+}
+
+// readSysfsAttr returns the trimmed contents of a sysfs attribute file
+func readSysfsAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// portPresent reports whether the device node still exists
+func portPresent(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
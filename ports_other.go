@@ -0,0 +1,30 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// scanPorts lists USB serial devices by their /dev names; USB descriptor
+// details are only available on Linux
+func scanPorts() ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, pattern := range []string{"/dev/tty.usb*", "/dev/ttyUSB*", "/dev/ttyACM*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			ports = append(ports, PortInfo{Path: m})
+		}
+	}
+	return ports, nil
+}
+
+// portPresent reports whether the device node still exists
+func portPresent(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
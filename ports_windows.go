@@ -0,0 +1,57 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// serialCommKey maps the kernel device of every serial port to its COM name
+const serialCommKey = `HARDWARE\DEVICEMAP\SERIALCOMM`
+
+// scanPorts lists the COM ports registered by serial drivers. The key only
+// exists while at least one port is present
+func scanPorts() ([]PortInfo, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, serialCommKey, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+
+	devices, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	var ports []PortInfo
+	for _, device := range devices {
+		name, _, err := key.GetStringValue(device)
+		if err != nil || name == "" {
+			continue
+		}
+		// e.g. \Device\USBSER000 for CDC-ACM, \Device\VCP0 for FTDI
+		ports = append(ports, PortInfo{Path: name, Product: device[strings.LastIndexByte(device, '\\')+1:]})
+	}
+	return ports, nil
+}
+
+// portPresent reports whether a COM port is still registered. COM names
+// are not filesystem paths, so the port cannot be checked with os.Stat
+func portPresent(path string) bool {
+	ports, err := scanPorts()
+	if err != nil {
+		// Keep a working port open when the registry cannot be read
+		return true
+	}
+	for _, p := range ports {
+		if strings.EqualFold(p.Path, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Protocol is the wire format spoken by a device
+type Protocol string
+
+const (
+	// ProtocolText is the board's own "ID;Field-value;..." line format
+	ProtocolText Protocol = "text"
+	// ProtocolNMEA is NMEA 0183 sentences from a GPS module
+	ProtocolNMEA Protocol = "nmea"
+	// ProtocolUBX is u-blox UBX binary output from a GPS module
+	ProtocolUBX Protocol = "ubx"
+	// ProtocolBinary is the board's compact COBS framed binary format
+	ProtocolBinary Protocol = "binary"
+)
+
+// protocolOptions lists the protocols selectable for a port
+var protocolOptions = []string{string(ProtocolText), string(ProtocolNMEA), string(ProtocolUBX), string(ProtocolBinary)}
+
+// ParseProtocol validates a protocol name; an empty name means text
+func ParseProtocol(name string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(name)); p {
+	case "":
+		return ProtocolText, nil
+	case ProtocolText, ProtocolNMEA, ProtocolUBX, ProtocolBinary:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown protocol %q", name)
+	}
+}
+
+// Decoder turns a device byte stream into source events
+type Decoder interface {
+	// Next reads from the stream until it has one event to report; its
+	// Raw may stay in the decoder's buffer until fillRaw is called, which
+	// must happen before the next call
+	Next() (SourceEvent, error)
+}
+
+// NewDecoder creates the decoder for a protocol
+func NewDecoder(proto Protocol, stream io.Reader) Decoder {
+	reader := bufio.NewReader(stream)
+	switch proto {
+	case ProtocolUBX:
+		return newUBXDecoder(reader)
+	case ProtocolBinary:
+		return &binaryDecoder{reader: reader}
+	case ProtocolNMEA:
+		asm := NewNMEAAssembler()
+		return &lineDecoder{reader: reader, decode: asm.Feed, response: isNMEAResponse}
+	default:
+		return &textDecoder{scanner: NewPacketScanner(reader)}
+	}
+}
+
+// lineDecoder frames newline terminated protocols
+type lineDecoder struct {
+	reader *bufio.Reader
+	// decode parses one line; complete is false for lines that only
+	// contribute to a later packet
+	decode func(line string, received time.Time) (p Packet, complete bool, err error)
+	// response tells device replies from damaged lines
+	response func(raw string) bool
+}
+
+func (d *lineDecoder) Next() (SourceEvent, error) {
+	for {
+		line, err := d.reader.ReadString('\n')
+		if line != "" && (err == nil || err == io.EOF) {
+			ev := SourceEvent{Raw: strings.TrimRight(line, "\r\n"), Time: time.Now()}
+			var complete bool
+			ev.Packet, complete, ev.Err = d.decode(line, ev.Time)
+			ev.Fragment = ev.Err == nil && !complete
+			ev.Response = ev.Err != nil && d.response(ev.Raw)
+			return ev, nil
+		}
+		if err != nil {
+			return SourceEvent{}, err
+		}
+	}
+}
+
+// textDecoder reads the board's own line format through PacketScanner.
+// Only failed lines are copied into Raw; valid ones are left for
+// readSource to copy when needed
+type textDecoder struct {
+	scanner *PacketScanner
+}
+
+func (d *textDecoder) Next() (SourceEvent, error) {
+	if !d.scanner.Scan() {
+		return SourceEvent{}, d.scanner.Err()
+	}
+	ev := SourceEvent{Time: time.Now(), line: bytes.TrimRight(d.scanner.Bytes(), "\r\n")}
+	ev.Packet, ev.Err = d.scanner.Packet()
+	if ev.Err != nil {
+		ev.fillRaw()
+		ev.Response = isResponseLine(ev.Raw)
+	}
+	return ev, nil
+}
+
+// protocolSource is implemented by sources that know their protocol
+type protocolSource interface {
+	Protocol() Protocol
+}
+
+// protocolOf returns the protocol of a source, text unless it says
+// otherwise
+func protocolOf(src PacketSource) Protocol {
+	if ps, ok := src.(protocolSource); ok {
+		return ps.Protocol()
+	}
+	return ProtocolText
+}
+
+// sourceWithProtocol overrides the protocol of a non-serial source
+type sourceWithProtocol struct {
+	PacketSource
+	proto Protocol
+}
+
+func (s sourceWithProtocol) Protocol() Protocol { return s.proto }
+func (s sourceWithProtocol) Replayed() bool     { return isReplay(s.PacketSource) }
+
+// replayedSource is implemented by sources playing back a recording,
+// whose packets were stored when they were first received
+type replayedSource interface {
+	Replayed() bool
+}
+
+// isReplay reports whether src plays back a recording
+func isReplay(src PacketSource) bool {
+	r, ok := src.(replayedSource)
+	return ok && r.Replayed()
+}
+
+// WithProtocol makes src decode its stream as proto; a session recorded
+// with a protocol header is always replayed in that protocol
+func WithProtocol(src PacketSource, proto Protocol) PacketSource {
+	if r, ok := src.(*ReplaySource); ok && r.proto != "" {
+		return src
+	}
+	if proto == ProtocolText {
+		return src
+	}
+	return sourceWithProtocol{PacketSource: src, proto: proto}
+}
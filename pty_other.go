@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY is only implemented on Linux
+func openPTY() (*os.File, string, error) {
+	return nil, "", errors.New("pseudo-terminals are only supported on Linux")
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session files start with a "# protocol=<name>" header naming the wire
+// protocol, then hold one received line per row, prefixed with the host
+// receive time: "<RFC3339Nano>\t<raw line>". Binary frames are stored
+// hex encoded as "<RFC3339Nano>\tbin:<hex>"
+const (
+	sessionTimeFormat     = time.RFC3339Nano
+	sessionBinaryPrefix   = "bin:"
+	sessionProtocolHeader = "# protocol="
+)
+
+// Recorder writes every raw line received from a source to a session file
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	path  string
+	lines int
+}
+
+// Start begins recording a source speaking proto to a new session file
+func (r *Recorder) Start(path string, proto Protocol) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		return fmt.Errorf("already recording to %s", r.path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %w", err)
+	}
+	r.file = f
+	r.w = bufio.NewWriter(f)
+	r.path = path
+	r.lines = 0
+	fmt.Fprintf(r.w, "%s%s\n", sessionProtocolHeader, proto)
+	return nil
+}
+
+// Stop finishes the session file and returns the number of lines recorded
+func (r *Recorder) Stop() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, nil
+	}
+
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	r.w = nil
+	if err != nil {
+		return r.lines, fmt.Errorf("failed to close session file: %w", err)
+	}
+	return r.lines, nil
+}
+
+// Active reports whether a session is being recorded
+func (r *Recorder) Active() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file != nil
+}
+
+// Record appends a received line to the session if one is active
+func (r *Recorder) Record(ev SourceEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A valid packet without raw text arrived just before recording began
+	if r.file == nil || ev.Raw == "" && ev.Err == nil {
+		return nil
+	}
+	raw := ev.Raw
+	if ev.Binary {
+		raw = sessionBinaryPrefix + hex.EncodeToString([]byte(ev.Raw))
+	}
+	if _, err := fmt.Fprintf(r.w, "%s\t%s\n", ev.Time.Format(sessionTimeFormat), raw); err != nil {
+		return fmt.Errorf("failed to record line: %w", err)
+	}
+	r.lines++
+	return nil
+}
+
+// GenerateSessionFilename creates a timestamped filename for recordings
+func GenerateSessionFilename() string {
+	timestamp := time.Now().Format("20060102_150405")
+	return fmt.Sprintf("komkomunikacijos_session_%s.log", timestamp)
+}
+
+// ReplaySource plays a recorded session back with its original timing,
+// scaled by Speed, or one line per Step call when Stepping is set
+type ReplaySource struct {
+	Path     string
+	Speed    float64
+	Stepping bool
+
+	proto Protocol // from the session header, empty in older sessions
+	steps chan struct{}
+}
+
+// NewReplaySource parses "path[?speed=N|?step]"
+func NewReplaySource(spec string) (*ReplaySource, error) {
+	path, query, _ := strings.Cut(spec, "?")
+	src := &ReplaySource{Path: path, Speed: 1, steps: make(chan struct{}, 1)}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay options %q: %w", query, err)
+	}
+	if v := params.Get("speed"); v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid replay speed %q", v)
+		}
+		src.Speed = speed
+	}
+	if params.Has("step") {
+		src.Stepping = true
+	}
+	if src.proto, err = readSessionProtocol(path); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// readSessionProtocol returns the protocol named in a session header, or
+// an empty protocol if the session was recorded without one
+func readSessionProtocol(path string) (Protocol, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	name, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), sessionProtocolHeader)
+	if !ok {
+		return "", nil
+	}
+	proto, err := ParseProtocol(name)
+	if err != nil {
+		return "", fmt.Errorf("bad session header in %s: %w", path, err)
+	}
+	return proto, nil
+}
+
+func (s *ReplaySource) Name() string {
+	if s.Stepping {
+		return "replay " + s.Path + " (step)"
+	}
+	return fmt.Sprintf("replay %s (%gx)", s.Path, s.Speed)
+}
+
+func (s *ReplaySource) Persistent() bool { return false }
+func (s *ReplaySource) Replayed() bool   { return true }
+
+// Protocol returns the protocol the session was recorded in, text for
+// sessions without a header
+func (s *ReplaySource) Protocol() Protocol {
+	if s.proto == "" {
+		return ProtocolText
+	}
+	return s.proto
+}
+
+func (s *ReplaySource) Open() (io.ReadCloser, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.Path, err)
+	}
+	return &replayStream{
+		src:     s,
+		file:    f,
+		scanner: bufio.NewScanner(f),
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+// Step releases the next line in stepping mode
+func (s *ReplaySource) Step() {
+	select {
+	case s.steps <- struct{}{}:
+	default:
+	}
+}
+
+// replayStream yields the recorded lines, waiting between them as the
+// recording did
+type replayStream struct {
+	src     *ReplaySource
+	file    *os.File
+	scanner *bufio.Scanner
+	closed  chan struct{}
+	once    sync.Once
+
+	last    time.Time
+	pending []byte
+}
+
+func (r *replayStream) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		// The header has no receive time and is skipped here
+		stamp, raw, ok := strings.Cut(r.scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(sessionTimeFormat, stamp)
+		if err != nil {
+			return 0, fmt.Errorf("bad session timestamp %q: %w", stamp, err)
+		}
+
+		if err := r.wait(t); err != nil {
+			return 0, err
+		}
+		if frame, ok := strings.CutPrefix(raw, sessionBinaryPrefix); ok {
+			r.pending, err = hex.DecodeString(frame)
+			if err != nil {
+				return 0, fmt.Errorf("bad binary frame in session: %w", err)
+			}
+		} else {
+			r.pending = append([]byte(raw), '\n')
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// wait blocks until the line recorded at t is due
+func (r *replayStream) wait(t time.Time) error {
+	var due <-chan time.Time
+
+	switch {
+	case r.src.Stepping:
+		select {
+		case <-r.src.steps:
+			return nil
+		case <-r.closed:
+			return errSourceClosed
+		}
+	case !r.last.IsZero() && t.After(r.last):
+		delay := time.Duration(float64(t.Sub(r.last)) / r.src.Speed)
+		due = time.After(delay)
+	}
+	r.last = t
+
+	if due == nil {
+		return nil
+	}
+	select {
+	case <-due:
+		return nil
+	case <-r.closed:
+		return errSourceClosed
+	}
+}
+
+func (r *replayStream) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return r.file.Close()
+}
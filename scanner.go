@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// PacketScanner reads text protocol lines from a stream and parses them
+// without allocating for well-formed packets made of schema core fields.
+// Anything else, including every malformed line, is handed to ParsePacket
+// so results and errors are identical to it
+type PacketScanner struct {
+	reader *bufio.Reader
+	long   []byte // line being assembled when it exceeds the buffer
+	line   []byte
+	packet Packet
+	perr   error
+	err    error
+
+	// The device ID and clock repeat from packet to packet; reusing the
+	// previous string avoids allocating one per line
+	lastID   string
+	lastTime string
+}
+
+// NewPacketScanner creates a scanner reading from stream
+func NewPacketScanner(stream io.Reader) *PacketScanner {
+	return &PacketScanner{reader: bufio.NewReader(stream)}
+}
+
+// Scan reads and parses the next line; it returns false when the stream
+// fails or ends, see Err
+func (s *PacketScanner) Scan() bool {
+	s.long = s.long[:0]
+	for {
+		chunk, err := s.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			s.long = append(s.long, chunk...)
+			continue
+		}
+		line := chunk
+		if len(s.long) > 0 {
+			s.long = append(s.long, chunk...)
+			line = s.long
+		}
+		if len(line) > 0 && (err == nil || err == io.EOF) {
+			s.line = line
+			s.packet, s.perr = s.parse(line)
+			return true
+		}
+		if err != nil {
+			s.err = err
+			return false
+		}
+	}
+}
+
+// Bytes returns the last line including its line ending; it is only valid
+// until the next Scan
+func (s *PacketScanner) Bytes() []byte { return s.line }
+
+// Packet returns the packet parsed from the last line and its parse error
+func (s *PacketScanner) Packet() (Packet, error) { return s.packet, s.perr }
+
+// Err returns the error that stopped Scan, io.EOF included
+func (s *PacketScanner) Err() error { return s.err }
+
+// parse tries the fast path and falls back to ParsePacket
+func (s *PacketScanner) parse(line []byte) (Packet, error) {
+	var p Packet
+	if s.parseFast(line, &p) {
+		return p, nil
+	}
+	return ParsePacket(string(line))
+}
+
+// parseFast parses a line of core fields into p, reporting false for
+// anything it does not handle
+func (s *PacketScanner) parseFast(line []byte, p *Packet) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return false
+	}
+
+	p.Checksum = ChecksumNone
+	if i := bytes.LastIndexByte(line, '*'); i >= 0 {
+		sum, ok := verifyChecksum(line[:i], line[i+1:])
+		if !ok {
+			return false
+		}
+		line, p.Checksum = line[:i], sum
+	}
+	if bytes.Count(line, []byte{';'}) < 5 {
+		return false
+	}
+
+	id, rest, _ := bytes.Cut(line, []byte{';'})
+	p.DeviceID = intern(&s.lastID, bytes.TrimSpace(id))
+
+	for {
+		field, tail, more := bytes.Cut(rest, []byte{';'})
+		// Empty fields are skipped like ParsePacket does
+		if len(field) > 0 && !assignFast(p, field, s) {
+			return false
+		}
+		if !more {
+			return true
+		}
+		rest = tail
+	}
+}
+
+// assignFast decodes one core field into its Packet member
+func assignFast(p *Packet, field []byte, s *PacketScanner) bool {
+	spec, ok := matchSpec(field)
+	if !ok {
+		return false
+	}
+	v := field[len(spec.Prefix):]
+
+	switch spec.Name {
+	case "Seq":
+		n, err := strconv.ParseUint(string(v), 10, 64)
+		if err != nil || n > math.MaxUint32 {
+			return false
+		}
+		p.Seq, p.HasSeq = uint32(n), true
+	case "Time":
+		p.Time = intern(&s.lastTime, v)
+	case "Latitude":
+		return parseFloatInto(&p.Latitude, v)
+	case "Longitude":
+		return parseFloatInto(&p.Longitude, v)
+	case "Satellites":
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return false
+		}
+		p.Satellites = int(n)
+	case "Altitude", "Speed", "Course", "HDOP", "PDOP":
+		var f float64
+		if !parseFloatInto(&f, v) {
+			return false
+		}
+		p.setGNSS(spec.Name, f)
+	case "Fix":
+		switch string(v) {
+		case "NONE":
+			p.Fix = FixNone
+		case "2D":
+			p.Fix = Fix2D
+		case "3D":
+			p.Fix = Fix3D
+		default:
+			return false
+		}
+		p.GNSS |= HasFix
+	case "Acceleration":
+		return parseAxesInto(&p.Acceleration, v)
+	case "Gyro":
+		p.IMU |= HasGyro
+		return parseAxesInto(&p.Gyro, v)
+	case "Magnetometer":
+		p.IMU |= HasMagnetometer
+		return parseAxesInto(&p.Magnetometer, v)
+	case "Temperature":
+		p.IMU |= HasTemperature
+		return parseFloatInto(&p.Temperature, v)
+	default:
+		// Schema extensions land in Extra, which allocates anyway
+		return false
+	}
+	return true
+}
+
+// matchSpec is FieldSchema.Match for byte slices
+func matchSpec(field []byte) (FieldSpec, bool) {
+	var best FieldSpec
+	found := false
+	for _, spec := range fieldSchema.Fields {
+		n := len(spec.Prefix)
+		if len(field) >= n && string(field[:n]) == spec.Prefix && n > len(best.Prefix) {
+			best, found = spec, true
+		}
+	}
+	return best, found
+}
+
+// verifyChecksum checks a 2 (XOR) or 4 (CRC-16) hex digit trailer
+// against body as splitChecksum does
+func verifyChecksum(body, trailer []byte) (ChecksumStatus, bool) {
+	if len(trailer) != 2 && len(trailer) != 4 {
+		return ChecksumNone, false
+	}
+	want, err := strconv.ParseUint(string(trailer), 16, 16)
+	if err != nil {
+		return ChecksumNone, false
+	}
+	body = bytes.TrimPrefix(body, []byte{'$'})
+	if len(trailer) == 2 {
+		return ChecksumXOR, uint64(checksumXOR(body)) == want
+	}
+	return ChecksumCRC16, uint64(checksumCRC16(body)) == want
+}
+
+func parseFloatInto(dst *float64, v []byte) bool {
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil {
+		return false
+	}
+	*dst = f
+	return true
+}
+
+// parseAxesInto reads exactly three comma separated floats
+func parseAxesInto(dst *[3]float64, v []byte) bool {
+	for i := range dst {
+		item, rest, found := bytes.Cut(v, []byte{','})
+		if found != (i < 2) || !parseFloatInto(&dst[i], item) {
+			return false
+		}
+		v = rest
+	}
+	return true
+}
+
+// intern returns *last if it equals b, otherwise stores and returns a new
+// string
+func intern(last *string, b []byte) string {
+	if string(b) != *last {
+		*last = string(b)
+	}
+	return *last
+}
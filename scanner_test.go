@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// simulatedLines returns lines as the simulator sends them, without
+// faults
+func simulatedLines(n int) [][]byte {
+	cfg := DefaultSimulatorConfig()
+	cfg.DropoutRate, cfg.CorruptRate, cfg.OutageRate = 0, 0, 0
+	cfg.Checksum = ChecksumXOR
+	sim := NewSimulator(cfg)
+
+	lines := make([][]byte, 0, n)
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	for len(lines) < n {
+		now = now.Add(100 * time.Millisecond)
+		if line, ok := sim.next(now, 0.1); ok {
+			lines = append(lines, []byte(line))
+		}
+	}
+	return lines
+}
+
+// lineReader streams count lines, cycling through lines
+type lineReader struct {
+	lines [][]byte
+	count int
+	next  int
+	rest  []byte
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.rest) == 0 {
+			if r.next == r.count {
+				break
+			}
+			r.rest = r.lines[r.next%len(r.lines)]
+			r.next++
+		}
+		c := copy(p[n:], r.rest)
+		r.rest = r.rest[c:]
+		n += c
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func reportPacketRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+}
+
+const scannerBase = "DEV1;Seq-42;Time-12:00:00.000;Latitude-54.6872;Longitude-25.2797;Satellites-9"
+
+// fletcherTrailer appends the UBX checksum of line as a 4 digit trailer,
+// which the text protocol reads as a CRC-16
+func fletcherTrailer(line string) string {
+	a, b := ubxChecksum([]byte(line))
+	return fmt.Sprintf("%s*%02X%02X", line, a, b)
+}
+
+var scannerCases = []struct {
+	name string
+	line string
+}{
+	{"core", scannerBase + ";Acceleration:0.01,-0.02,0.98\n"},
+	{"all core fields", scannerBase + ";Altitude-112.5;Speed-3.6;Course-271;HDOP-0.9;PDOP-1.4;Fix-3D;Acceleration:0,0,1;Gyro:1,2,3;Mag:20,-5,40;Temp-31.5\n"},
+	{"no line ending", scannerBase + ";Acceleration:0,0,1"},
+	{"CRLF", scannerBase + ";Acceleration:0,0,1\r\n"},
+	{"surrounding space", "  " + scannerBase + ";Acceleration:0,0,1 \r\n"},
+
+	{"XOR trailer", AppendChecksum(scannerBase+";Acceleration:0,0,1", ChecksumXOR) + "\n"},
+	{"CRC trailer", AppendChecksum(scannerBase+";Acceleration:0,0,1", ChecksumCRC16) + "\r\n"},
+	{"XOR trailer with dollar", AppendChecksum("$"+scannerBase+";Acceleration:0,0,1", ChecksumXOR)},
+	{"bad XOR trailer", scannerBase + ";Acceleration:0,0,1*00\n"},
+	{"bad CRC trailer", scannerBase + ";Acceleration:0,0,1*0000\n"},
+	{"Fletcher trailer", fletcherTrailer(scannerBase+";Acceleration:0,0,1") + "\n"},
+	{"short trailer", scannerBase + ";Acceleration:0,0,1*7\n"},
+	{"long trailer", scannerBase + ";Acceleration:0,0,1*12345\n"},
+	{"non-hex trailer", scannerBase + ";Acceleration:0,0,1*ZZ\n"},
+	{"empty trailer", scannerBase + ";Acceleration:0,0,1*\n"},
+
+	{"fix none", scannerBase + ";Fix-NONE;Acceleration:0,0,1"},
+	{"fix 2D", scannerBase + ";Fix-2D;Acceleration:0,0,1"},
+	{"fix 3D", scannerBase + ";Fix-3D;Acceleration:0,0,1"},
+	{"fix lower case", scannerBase + ";Fix-3d;Acceleration:0,0,1"},
+	{"fix unknown", scannerBase + ";Fix-4D;Acceleration:0,0,1"},
+	{"fix empty", scannerBase + ";Fix-;Acceleration:0,0,1"},
+
+	{"seq max", "DEV1;Seq-4294967295;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3;Acceleration:0,0,1"},
+	{"seq overflow", "DEV1;Seq-4294967296;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3;Acceleration:0,0,1"},
+	{"seq overflow uint64", "DEV1;Seq-18446744073709551616;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3;Acceleration:0,0,1"},
+	{"seq negative", "DEV1;Seq--1;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3;Acceleration:0,0,1"},
+	{"seq sign", "DEV1;Seq-+1;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3;Acceleration:0,0,1"},
+
+	{"3 axes", scannerBase + ";Acceleration:1,2,3;Gyro:4,5,6;Mag:7,8,9"},
+	{"4 acceleration axes", scannerBase + ";Acceleration:1,2,3,4"},
+	{"4 gyro axes", scannerBase + ";Acceleration:1,2,3;Gyro:4,5,6,7"},
+	{"4 magnetometer axes", scannerBase + ";Acceleration:1,2,3;Mag:7,8,9,10"},
+	{"2 axes", scannerBase + ";Acceleration:1,2"},
+	{"empty axis", scannerBase + ";Acceleration:1,,3"},
+	{"trailing comma", scannerBase + ";Acceleration:1,2,3,"},
+
+	{"empty fields", "DEV1;;Seq-42;;Time-12:00:00;Latitude-1;Longitude-2;;Satellites-3;Acceleration:0,0,1;\n"},
+	{"empty values", scannerBase + ";Altitude-;Acceleration:0,0,1"},
+	{"empty device", ";Seq-1;Time-12:00:00;Latitude-1;Longitude-2;Satellites-3"},
+	{"extension field", scannerBase + ";Acceleration:0,0,1;Battery-3.7"},
+	{"unknown field", scannerBase + ";Acceleration:0,0,1;foo=bar"},
+	{"repeated field", scannerBase + ";Latitude-10;Acceleration:0,0,1"},
+	{"bad number", scannerBase + ";Altitude-1.2.3;Acceleration:0,0,1"},
+	{"special floats", scannerBase + ";Altitude-NaN;Speed-Inf;Course-0x1p4;Acceleration:0,0,1"},
+
+	{"empty line", "\n"},
+	{"blank line", "   \r\n"},
+	{"truncated fields", "DEV1;Seq-42;Time-12:00:00;Latitude-54.6\n"},
+	{"truncated value", "DEV1;Seq-42;Time-12:00:00;Latitude-54.6;Longitude-25.2;Satellites-"},
+	{"truncated prefix", "DEV1;Seq-42;Time-12:00:00;Latitude-54.6;Longitude-25.2;Satel"},
+	{"truncated axes", scannerBase + ";Acceleration:0.01,-0."},
+	{"truncated trailer", scannerBase + ";Acceleration:0,0,1*"},
+}
+
+// samePacket compares packets treating NaN values as equal
+func samePacket(a, b Packet) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprintf("%#v", a) == fmt.Sprintf("%#v", b)
+}
+
+// checkScanner feeds data to a PacketScanner and compares every line it
+// scans with ParsePacket
+func checkScanner(t *testing.T, data string) {
+	t.Helper()
+	s := NewPacketScanner(strings.NewReader(data))
+	for s.Scan() {
+		line := string(s.Bytes())
+		got, gotErr := s.Packet()
+		want, wantErr := ParsePacket(line)
+		if !samePacket(got, want) {
+			t.Errorf("%q:\n got %+v\nwant %+v", line, got, want)
+		}
+		if !reflect.DeepEqual(gotErr, wantErr) {
+			t.Errorf("%q: error %v, want %v", line, gotErr, wantErr)
+		}
+	}
+	if s.Err() != io.EOF {
+		t.Errorf("scanner stopped with %v", s.Err())
+	}
+}
+
+func TestPacketScannerMatchesParsePacket(t *testing.T) {
+	for _, tc := range scannerCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkScanner(t, tc.line)
+		})
+	}
+
+	// One stream, so the scanner reuses its state from line to line
+	var all strings.Builder
+	for _, tc := range scannerCases {
+		all.WriteString(tc.line)
+		if !strings.HasSuffix(tc.line, "\n") {
+			all.WriteString("\n")
+		}
+	}
+	checkScanner(t, all.String())
+}
+
+func FuzzPacketScanner(f *testing.F) {
+	for _, tc := range scannerCases {
+		f.Add(tc.line)
+	}
+	for _, line := range simulatedLines(20) {
+		f.Add(string(line))
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		checkScanner(t, data)
+	})
+}
+
+func BenchmarkPacketScanner(b *testing.B) {
+	s := NewPacketScanner(&lineReader{lines: simulatedLines(1000), count: b.N})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if !s.Scan() {
+			b.Fatal(s.Err())
+		}
+		if _, err := s.Packet(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportPacketRate(b)
+}
+
+func BenchmarkParsePacket(b *testing.B) {
+	raw := simulatedLines(1000)
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		lines[i] = string(line)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		if _, err := ParsePacket(lines[i%len(lines)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportPacketRate(b)
+}
+
+// BenchmarkLineDecoderBaseline measures the text path as it was before
+// PacketScanner: a line read as a string and split by ParsePacket
+func BenchmarkLineDecoderBaseline(b *testing.B) {
+	dec := &lineDecoder{
+		reader: bufio.NewReader(&lineReader{lines: simulatedLines(1000), count: b.N}),
+		decode: func(line string, _ time.Time) (Packet, bool, error) {
+			p, err := ParsePacket(line)
+			return p, err == nil, err
+		},
+		response: isResponseLine,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		ev, err := dec.Next()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if ev.Err != nil {
+			b.Fatal(ev.Err)
+		}
+	}
+	reportPacketRate(b)
+}
+
+// BenchmarkTextSource measures the whole reading path of a text source:
+// decoding, device time, validation, with the monitor hidden
+func BenchmarkTextSource(b *testing.B) {
+	stream := &lineReader{lines: simulatedLines(1000), count: b.N}
+	b.ReportAllocs()
+	b.ResetTimer()
+	err := readSource(stream, ProtocolText, func() bool { return false }, func(ev SourceEvent) {
+		if ev.Err != nil {
+			b.Fatal(ev.Err)
+		}
+	})
+	if err != io.EOF {
+		b.Fatal(err)
+	}
+	reportPacketRate(b)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldType is the value type of a packet field
+type FieldType string
+
+const (
+	FieldFloat  FieldType = "float"
+	FieldInt    FieldType = "int"
+	FieldUint   FieldType = "uint"
+	FieldString FieldType = "string"
+)
+
+// FieldSpec declares one packet field: the prefix that introduces it on the
+// wire, its type, unit and, for arrays, the number of comma separated items
+type FieldSpec struct {
+	Name   string    `json:"name"`
+	Prefix string    `json:"prefix"`
+	Type   FieldType `json:"type"`
+	Unit   string    `json:"unit,omitempty"`
+	Length int       `json:"length,omitempty"` // 0 or 1 for scalars
+}
+
+// FieldSchema is the set of fields the parser understands. Fields with a
+// dedicated Packet member are decoded into it; the rest land in Packet.Extra
+type FieldSchema struct {
+	Fields []FieldSpec
+}
+
+// coreFields are the fields every device sends and the parser maps onto
+// Packet members
+var coreFields = []FieldSpec{
+	{Name: "Seq", Prefix: "Seq-", Type: FieldUint},
+	{Name: "Time", Prefix: "Time-", Type: FieldString},
+	{Name: "Latitude", Prefix: "Latitude-", Type: FieldFloat, Unit: "°"},
+	{Name: "Longitude", Prefix: "Longitude-", Type: FieldFloat, Unit: "°"},
+	{Name: "Satellites", Prefix: "Satellites-", Type: FieldInt},
+	{Name: "Altitude", Prefix: "Altitude-", Type: FieldFloat, Unit: "m"},
+	{Name: "Speed", Prefix: "Speed-", Type: FieldFloat, Unit: "km/h"},
+	{Name: "Course", Prefix: "Course-", Type: FieldFloat, Unit: "°"},
+	{Name: "HDOP", Prefix: "HDOP-", Type: FieldFloat},
+	{Name: "PDOP", Prefix: "PDOP-", Type: FieldFloat},
+	{Name: "Fix", Prefix: "Fix-", Type: FieldString},
+	{Name: "Acceleration", Prefix: "Acceleration:", Type: FieldFloat, Unit: "g", Length: 3},
+	{Name: "Gyro", Prefix: "Gyro:", Type: FieldFloat, Unit: "°/s", Length: 3},
+	{Name: "Magnetometer", Prefix: "Mag:", Type: FieldFloat, Unit: "µT", Length: 3},
+	{Name: "Temperature", Prefix: "Temp-", Type: FieldFloat, Unit: "°C"},
+}
+
+// DefaultFieldSchema returns the schema of the original firmware
+func DefaultFieldSchema() *FieldSchema {
+	return &FieldSchema{Fields: append([]FieldSpec(nil), coreFields...)}
+}
+
+// fieldSchema is used by ParsePacket
+var fieldSchema = DefaultFieldSchema()
+
+// LoadFieldSchema reads a JSON array of field specs and adds them to the
+// default schema; a spec with the name of an existing field replaces it
+func LoadFieldSchema(path string) (*FieldSchema, error) {
+	schema := DefaultFieldSchema()
+	if path == "" {
+		return schema, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field schema: %w", err)
+	}
+	var specs []FieldSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse field schema: %w", err)
+	}
+
+	for _, spec := range specs {
+		if err := spec.validate(); err != nil {
+			return nil, err
+		}
+		for _, core := range coreFields {
+			if core.Name == spec.Name && (core.Type != spec.Type || core.Length != spec.Length) {
+				return nil, fmt.Errorf("field schema: %s may only change its prefix and unit", spec.Name)
+			}
+		}
+		schema.set(spec)
+	}
+	return schema, nil
+}
+
+func (s FieldSpec) validate() error {
+	if s.Name == "" || s.Prefix == "" {
+		return fmt.Errorf("field schema: name and prefix are required (%+v)", s)
+	}
+	switch s.Type {
+	case FieldFloat, FieldInt, FieldUint, FieldString:
+	default:
+		return fmt.Errorf("field schema: %s has unknown type %q", s.Name, s.Type)
+	}
+	if s.Length < 0 {
+		return fmt.Errorf("field schema: %s has negative length", s.Name)
+	}
+	return nil
+}
+
+func (s *FieldSchema) set(spec FieldSpec) {
+	for i := range s.Fields {
+		if s.Fields[i].Name == spec.Name {
+			s.Fields[i] = spec
+			return
+		}
+	}
+	s.Fields = append(s.Fields, spec)
+}
+
+// Match returns the spec whose prefix starts the field, preferring the
+// longest prefix
+func (s *FieldSchema) Match(field string) (FieldSpec, bool) {
+	var best FieldSpec
+	found := false
+	for _, spec := range s.Fields {
+		if strings.HasPrefix(field, spec.Prefix) && len(spec.Prefix) > len(best.Prefix) {
+			best, found = spec, true
+		}
+	}
+	return best, found
+}
+
+// Spec looks up a field by name
+func (s *FieldSchema) Spec(name string) (FieldSpec, bool) {
+	for _, spec := range s.Fields {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return FieldSpec{}, false
+}
+
+// Unit returns the unit of a named field, if the schema declares one
+func (s *FieldSchema) Unit(name string) string {
+	spec, _ := s.Spec(name)
+	return spec.Unit
+}
+
+// Decode converts a raw field value according to the spec: float64, int64,
+// uint64 or string for scalars and a slice of those for arrays. at is the
+// offset of value in line, used for errors
+func (s FieldSpec) Decode(value, line string, at int) (any, error) {
+	if s.Length <= 1 {
+		return s.decodeScalar(value, line, at)
+	}
+
+	items := strings.Split(value, ",")
+	if len(items) != s.Length {
+		return nil, &ParseError{Kind: ParseTruncated, Field: s.Name, Value: value, Offset: at, Line: line,
+			Err: fmt.Errorf("%d of %d items", len(items), s.Length)}
+	}
+	out := make([]any, len(items))
+	for i, item := range items {
+		v, err := s.decodeScalar(item, line, at)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+		at += len(item) + 1
+	}
+	return out, nil
+}
+
+func (s FieldSpec) decodeScalar(value, line string, at int) (any, error) {
+	var (
+		v   any
+		err error
+	)
+	switch s.Type {
+	case FieldFloat:
+		v, err = strconv.ParseFloat(value, 64)
+	case FieldInt:
+		v, err = strconv.ParseInt(value, 10, 64)
+	case FieldUint:
+		v, err = strconv.ParseUint(value, 10, 64)
+	default:
+		v = value
+	}
+	if err != nil {
+		return nil, numberError(line, s.Name, value, at, err)
+	}
+	return v, nil
+}
+
+// splitUnknownField separates the name of a field missing from the schema
+// from its value at the first '-' or ':'
+func splitUnknownField(field string) (name, value string) {
+	if i := strings.IndexAny(field, "-:"); i > 0 {
+		return field[:i], field[i+1:]
+	}
+	return field, ""
+}
+
+// formatExtra renders extra fields as "Name:value unit" pairs sorted by name
+func formatExtra(extra map[string]any, schema *FieldSchema) string {
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		txt := fmt.Sprintf("%s:%v", name, extra[name])
+		if unit := schema.Unit(name); unit != "" {
+			txt += unit
+		}
+		parts = append(parts, txt)
+	}
+	return strings.Join(parts, " ")
+}
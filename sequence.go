@@ -0,0 +1,148 @@
+package main
+
+import "sort"
+
+const (
+	// missingWindow bounds how far back missing sequence numbers are
+	// remembered to tell a late (reordered) packet from a duplicate
+	missingWindow = 256
+	// maxSequenceGap is the largest jump still counted as lost packets
+	maxSequenceGap = 1 << 16
+	// restartRun is how many consecutive older sequence numbers are taken
+	// as a restarted counter rather than duplicates
+	restartRun = 3
+)
+
+// SequenceStats summarises packet delivery for one device
+type SequenceStats struct {
+	DeviceID   string
+	Received   int
+	Lost       int
+	Duplicates int
+	Reordered  int
+}
+
+type deviceSequence struct {
+	stats   SequenceStats
+	last    uint32
+	started bool
+	missing map[uint32]struct{}
+
+	// The latest sequence number older than last and the length of the
+	// run of consecutive numbers ending in it
+	backSeq uint32
+	backRun int
+}
+
+// restart follows a device that started counting again from seq
+func (d *deviceSequence) restart(seq uint32) {
+	d.last = seq
+	d.backRun = 0
+	clear(d.missing)
+}
+
+// SequenceTracker detects lost, duplicated and reordered packets per device
+// from their sequence numbers; counters are 32-bit and may wrap
+type SequenceTracker struct {
+	devices map[string]*deviceSequence
+}
+
+// NewSequenceTracker creates an empty tracker
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{devices: make(map[string]*deviceSequence)}
+}
+
+// Observe accounts for a received packet; packets without a sequence
+// number are ignored
+func (t *SequenceTracker) Observe(p Packet) {
+	if !p.HasSeq {
+		return
+	}
+
+	d, ok := t.devices[p.DeviceID]
+	if !ok {
+		d = &deviceSequence{
+			stats:   SequenceStats{DeviceID: p.DeviceID},
+			missing: make(map[uint32]struct{}),
+		}
+		t.devices[p.DeviceID] = d
+	}
+	d.stats.Received++
+
+	if !d.started {
+		d.started = true
+		d.last = p.Seq
+		return
+	}
+
+	// Modular difference handles counter wrap-around
+	diff := p.Seq - d.last
+	switch {
+	case diff == 0:
+		d.stats.Duplicates++
+		d.backRun = 0
+	case diff > maxSequenceGap && -diff > missingWindow:
+		// Too far ahead to be loss and too far back to be reordering:
+		// the device restarted its counter
+		d.restart(p.Seq)
+	case diff <= maxSequenceGap:
+		d.backRun = 0
+		d.stats.Lost += int(diff - 1)
+		start := d.last + 1
+		if diff-1 > missingWindow {
+			start = p.Seq - missingWindow
+		}
+		for s := start; s != p.Seq; s++ {
+			d.missing[s] = struct{}{}
+		}
+		d.last = p.Seq
+		for s := range d.missing {
+			if d.last-s > missingWindow {
+				delete(d.missing, s)
+			}
+		}
+	default:
+		// Older than the newest packet: late if we were missing it
+		if _, ok := d.missing[p.Seq]; ok {
+			delete(d.missing, p.Seq)
+			d.stats.Lost--
+			d.stats.Reordered++
+			d.backRun = 0
+			return
+		}
+
+		if d.backRun > 0 && p.Seq == d.backSeq+1 {
+			d.backRun++
+		} else {
+			d.backRun = 1
+		}
+		d.backSeq = p.Seq
+
+		// A counter back at zero, or older numbers that keep counting
+		// up, mean the device restarted soon after its last start
+		if p.Seq <= 1 || d.backRun >= restartRun {
+			// The earlier packets of the run were taken for duplicates
+			d.stats.Duplicates -= d.backRun - 1
+			d.restart(p.Seq)
+		} else {
+			d.stats.Duplicates++
+		}
+	}
+}
+
+// Stats returns the counters of every device, sorted by device ID
+func (t *SequenceTracker) Stats() []SequenceStats {
+	stats := make([]SequenceStats, 0, len(t.devices))
+	for _, d := range t.devices {
+		stats = append(stats, d.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].DeviceID < stats[j].DeviceID
+	})
+	return stats
+}
+
+// Reset forgets all devices
+func (t *SequenceTracker) Reset() {
+	t.devices = make(map[string]*deviceSequence)
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+// seqRange returns the sequence numbers from first to last inclusive
+func seqRange(first, last uint32) []uint32 {
+	var seqs []uint32
+	for s := first; s <= last; s++ {
+		seqs = append(seqs, s)
+	}
+	return seqs
+}
+
+func TestSequenceTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		seqs [][]uint32
+		want SequenceStats
+	}{
+		{"in order", [][]uint32{seqRange(1, 100)},
+			SequenceStats{Received: 100}},
+		{"lost", [][]uint32{seqRange(1, 10), seqRange(14, 20)},
+			SequenceStats{Received: 17, Lost: 3}},
+		{"reordered", [][]uint32{{1, 2, 4, 3, 5}},
+			SequenceStats{Received: 5, Reordered: 1}},
+		{"duplicate", [][]uint32{seqRange(1, 10), {10, 5}, seqRange(11, 12)},
+			SequenceStats{Received: 14, Duplicates: 2}},
+		{"wrap", [][]uint32{{4294967294, 4294967295, 0, 2}},
+			SequenceStats{Received: 4, Lost: 1}},
+		{"restart after a long run", [][]uint32{seqRange(1, 5000), seqRange(1, 10)},
+			SequenceStats{Received: 5010}},
+		{"restart soon after start", [][]uint32{seqRange(1, 100), seqRange(1, 50)},
+			SequenceStats{Received: 150}},
+		{"restart from zero", [][]uint32{seqRange(0, 20), seqRange(0, 20)},
+			SequenceStats{Received: 42}},
+		{"restart then loss", [][]uint32{seqRange(1, 200), seqRange(1, 50), seqRange(53, 60)},
+			SequenceStats{Received: 258, Lost: 2}},
+		{"restart at a later number", [][]uint32{seqRange(1, 100), seqRange(10, 30)},
+			SequenceStats{Received: 121}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := NewSequenceTracker()
+			for _, run := range tc.seqs {
+				for _, s := range run {
+					tr.Observe(Packet{DeviceID: "DEV1", Seq: s, HasSeq: true})
+				}
+			}
+			tc.want.DeviceID = "DEV1"
+			if got := tr.Stats(); len(got) != 1 || got[0] != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// SerialSettings holds the line settings used to open a port
+type SerialSettings struct {
+	Baud          int    `json:"baud"`
+	DataBits      int    `json:"data_bits"`
+	Parity        string `json:"parity"`       // none, odd, even, mark, space
+	StopBits      string `json:"stop_bits"`    // 1, 1.5, 2
+	FlowControl   string `json:"flow_control"` // none, rtscts, xonxoff
+	ReadTimeoutMs int    `json:"read_timeout_ms"`
+	Protocol      string `json:"protocol,omitempty"` // text, nmea, ubx, binary; empty means text
+}
+
+var (
+	dataBitsOptions    = []string{"8", "7", "6", "5"}
+	parityOptions      = []string{"none", "odd", "even", "mark", "space"}
+	stopBitsOptions    = []string{"1", "1.5", "2"}
+	readTimeoutOptions = []string{"100", "500", "1000", "2000"}
+)
+
+// DefaultSerialSettings returns 8N1 at 115200 baud
+func DefaultSerialSettings() SerialSettings {
+	return SerialSettings{
+		Baud:          115200,
+		DataBits:      8,
+		Parity:        "none",
+		StopBits:      "1",
+		FlowControl:   "none",
+		ReadTimeoutMs: 500,
+	}
+}
+
+// Validate checks that the settings can be applied by the serial driver
+func (s SerialSettings) Validate() error {
+	if s.Baud <= 0 {
+		return fmt.Errorf("invalid baud rate %d", s.Baud)
+	}
+	if s.DataBits < 5 || s.DataBits > 8 {
+		return fmt.Errorf("invalid data bits %d (must be 5-8)", s.DataBits)
+	}
+
+	switch s.Parity {
+	case "none", "odd", "even":
+	case "mark", "space":
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("%s parity is not supported on %s", s.Parity, runtime.GOOS)
+		}
+	default:
+		return fmt.Errorf("invalid parity %q", s.Parity)
+	}
+
+	switch s.StopBits {
+	case "1", "2":
+	case "1.5":
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("1.5 stop bits are not supported on %s", runtime.GOOS)
+		}
+	default:
+		return fmt.Errorf("invalid stop bits %q", s.StopBits)
+	}
+
+	switch s.FlowControl {
+	case "", "none":
+	case "rtscts", "xonxoff":
+		return fmt.Errorf("flow control %q is not supported by the serial driver", s.FlowControl)
+	default:
+		return fmt.Errorf("invalid flow control %q", s.FlowControl)
+	}
+
+	if _, err := ParseProtocol(s.Protocol); err != nil {
+		return err
+	}
+
+	// The driver expresses timeouts in tenths of a second, up to 25.5 s
+	if s.ReadTimeoutMs < 100 || s.ReadTimeoutMs > 25500 {
+		return fmt.Errorf("invalid read timeout %d ms (must be 100-25500)", s.ReadTimeoutMs)
+	}
+	return nil
+}
+
+// ReadTimeout returns the read timeout as a duration
+func (s SerialSettings) ReadTimeout() time.Duration {
+	return time.Duration(s.ReadTimeoutMs) * time.Millisecond
+}
+
+// String formats the settings in the usual "115200 8N1" notation
+func (s SerialSettings) String() string {
+	p := "N"
+	if s.Parity != "" {
+		p = string(s.Parity[0] - 'a' + 'A')
+	}
+	return fmt.Sprintf("%d %d%s%s", s.Baud, s.DataBits, p, s.StopBits)
+}
+
+// WireProtocol returns the protocol the device speaks
+func (s SerialSettings) WireProtocol() Protocol {
+	p, err := ParseProtocol(s.Protocol)
+	if err != nil {
+		return ProtocolText
+	}
+	return p
+}
+
+// serialConfig converts validated settings into a tarm/serial config
+func (s SerialSettings) serialConfig(name string) *serial.Config {
+	cfg := &serial.Config{
+		Name:        name,
+		Baud:        s.Baud,
+		Size:        byte(s.DataBits),
+		ReadTimeout: s.ReadTimeout(),
+	}
+
+	switch s.Parity {
+	case "odd":
+		cfg.Parity = serial.ParityOdd
+	case "even":
+		cfg.Parity = serial.ParityEven
+	case "mark":
+		cfg.Parity = serial.ParityMark
+	case "space":
+		cfg.Parity = serial.ParitySpace
+	default:
+		cfg.Parity = serial.ParityNone
+	}
+
+	switch s.StopBits {
+	case "1.5":
+		cfg.StopBits = serial.Stop1Half
+	case "2":
+		cfg.StopBits = serial.Stop2
+	default:
+		cfg.StopBits = serial.Stop1
+	}
+
+	return cfg
+}
+
+// SettingsStore persists serial settings per device in a JSON file
+type SettingsStore struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]SerialSettings
+}
+
+// LoadSettingsStore reads the settings file, starting empty if it does not
+// exist yet
+func LoadSettingsStore(path string) (*SettingsStore, error) {
+	store := &SettingsStore{
+		path:    path,
+		devices: make(map[string]SerialSettings),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return store, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.devices); err != nil {
+		return store, fmt.Errorf("failed to parse settings %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Get returns the saved settings for a device, or the defaults
+func (s *SettingsStore) Get(device PortInfo) SerialSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg, ok := s.devices[deviceKey(device)]; ok {
+		return cfg
+	}
+	return DefaultSerialSettings()
+}
+
+// Set stores the settings for a device and writes the file
+func (s *SettingsStore) Set(device PortInfo, cfg SerialSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.devices[deviceKey(device)] = cfg
+
+	data, err := json.MarshalIndent(s.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create settings directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// deviceKey identifies a device across reconnects and /dev renames
+func deviceKey(device PortInfo) string {
+	switch {
+	case device.SerialNumber != "":
+		return fmt.Sprintf("usb:%s:%s:%s", device.VID, device.PID, device.SerialNumber)
+	case device.ByID != "":
+		return device.ByID
+	default:
+		return device.Path
+	}
+}
+
+// getSettingsPath returns the location of the serial settings file
+func getSettingsPath() string {
+	if path := os.Getenv("SERIAL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "serial_settings.json"
+	}
+	return filepath.Join(dir, "komkomunikacijos", "serial_settings.json")
+}
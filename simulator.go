@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackPoint is a waypoint of a scripted GPS track
+type TrackPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// SimulatorConfig controls the simulated device
+type SimulatorConfig struct {
+	DeviceID    string
+	Rate        float64      // packets per second
+	Speed       float64      // ground speed in m/s
+	Track       []TrackPoint // scripted track; a random walk is used when empty
+	DropoutRate float64      // probability that a packet is not sent
+	CorruptRate float64      // probability that a sent line is corrupted
+	OutageRate  float64      // probability per second that satellites are lost
+	OutageTime  time.Duration
+	Checksum    ChecksumStatus // trailer appended to every text line
+	Format      Protocol       // wire format of the packets; empty means text
+}
+
+// DefaultSimulatorConfig walks around Vilnius at 10 packets per second
+// with occasional faults
+func DefaultSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		DeviceID:    "SIM01",
+		Rate:        10,
+		Speed:       1.5,
+		DropoutRate: 0.01,
+		CorruptRate: 0.01,
+		OutageRate:  0.005,
+		OutageTime:  5 * time.Second,
+	}
+}
+
+const (
+	simStartLatitude  = 54.687157
+	simStartLongitude = 25.279652
+	simAltitude       = 112.0 // metres, Vilnius old town
+	metersPerDegree   = 111320.0
+	accelNoise        = 0.02 // g
+	gyroNoise         = 0.3  // °/s
+	magNoise          = 0.5  // µT
+	earthFieldH       = 17.0 // µT, horizontal component in Lithuania
+	earthFieldZ       = 48.0 // µT, vertical component
+)
+
+// Simulator generates a continuous packet stream like the real board
+type Simulator struct {
+	cfg SimulatorConfig
+	rng *rand.Rand
+
+	lat, lon    float64
+	heading     float64 // radians, 0 = north
+	waypoint    int
+	satellites  int
+	outageUntil time.Time
+	seq         uint32
+	turnRate    float64 // radians per second of the last move
+	started     time.Time
+}
+
+// NewSimulator creates a simulator starting at the first track point or
+// in central Vilnius
+func NewSimulator(cfg SimulatorConfig) *Simulator {
+	s := &Simulator{
+		cfg:        cfg,
+		rng:        rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+		lat:        simStartLatitude,
+		lon:        simStartLongitude,
+		satellites: 9,
+		started:    time.Now(),
+	}
+	if s.cfg.Format == "" {
+		s.cfg.Format = ProtocolText
+	}
+	if len(cfg.Track) > 0 {
+		s.lat = cfg.Track[0].Latitude
+		s.lon = cfg.Track[0].Longitude
+	}
+	s.heading = s.rng.Float64() * 2 * math.Pi
+	return s
+}
+
+// Run writes packets to w at the configured rate and answers commands
+// received on cmds until stop is closed
+func (s *Simulator) Run(w io.Writer, cmds <-chan string, stop <-chan struct{}) error {
+	interval := time.Duration(float64(time.Second) / s.cfg.Rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case cmd := <-cmds:
+			reply := s.command(cmd)
+			if next := time.Duration(float64(time.Second) / s.cfg.Rate); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+			reply += "\r\n"
+			if s.cfg.Format == ProtocolBinary {
+				// Delimit the reply so it does not run into the next frame
+				reply += "\x00"
+			}
+			if _, err := io.WriteString(w, reply); err != nil {
+				return fmt.Errorf("simulator write failed: %w", err)
+			}
+		case now := <-ticker.C:
+			line, ok := s.next(now, interval.Seconds())
+			if !ok {
+				continue
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return fmt.Errorf("simulator write failed: %w", err)
+			}
+		}
+	}
+}
+
+// command executes a console command like the board firmware does and
+// returns the reply line
+func (s *Simulator) command(cmd string) string {
+	fields := strings.Fields(strings.ToUpper(cmd))
+	if len(fields) == 0 {
+		return "ERR empty command"
+	}
+
+	switch fields[0] {
+	case "STATUS":
+		return fmt.Sprintf("OK %s rate=%g sats=%d", s.cfg.DeviceID, s.cfg.Rate, s.satellites)
+	case "RESET":
+		s.lat, s.lon, s.waypoint, s.seq = simStartLatitude, simStartLongitude, 0, 0
+		if len(s.cfg.Track) > 0 {
+			s.lat, s.lon = s.cfg.Track[0].Latitude, s.cfg.Track[0].Longitude
+		}
+		return "OK reset"
+	case "RATE":
+		if len(fields) != 2 {
+			return "ERR usage: RATE <hz>"
+		}
+		rate, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || rate <= 0 || rate > 1000 {
+			return "ERR invalid rate " + fields[1]
+		}
+		s.cfg.Rate = rate
+		return fmt.Sprintf("OK rate=%g", rate)
+	default:
+		return "ERR unknown command " + fields[0]
+	}
+}
+
+// next advances the simulation by dt seconds and returns the encoded
+// packet to send, or false if the packet is dropped
+func (s *Simulator) next(now time.Time, dt float64) (string, bool) {
+	s.move(dt)
+	s.updateSatellites(now, dt)
+	s.seq++
+
+	if s.rng.Float64() < s.cfg.DropoutRate {
+		return "", false
+	}
+
+	lat, lon := s.lat, s.lon
+	fix := Fix3D
+	if s.satellites < 4 {
+		// No fix: the board reports zero coordinates
+		lat, lon = 0, 0
+		fix = FixNone
+	}
+
+	// Dilution of precision shrinks roughly with the satellites in view
+	hdop := 8 / float64(max(s.satellites, 1))
+	course := math.Mod(s.heading*180/math.Pi+360, 360)
+	altitude := simAltitude + 2*math.Sin(float64(now.Unix())/60.0)
+
+	// Gravity on Z plus sensor noise and a little walking bounce
+	bounce := 0.05 * math.Sin(float64(now.UnixMilli())/300.0)
+	acc := [3]float64{
+		s.rng.NormFloat64() * accelNoise,
+		s.rng.NormFloat64() * accelNoise,
+		1 + bounce + s.rng.NormFloat64()*accelNoise,
+	}
+
+	// Slow turning on Z, the Earth's field rotated by the heading and a
+	// die slowly warming up
+	gyro := [3]float64{
+		s.rng.NormFloat64() * gyroNoise,
+		s.rng.NormFloat64() * gyroNoise,
+		s.turnRate*180/math.Pi + s.rng.NormFloat64()*gyroNoise,
+	}
+	mag := [3]float64{
+		earthFieldH*math.Cos(s.heading) + s.rng.NormFloat64()*magNoise,
+		-earthFieldH*math.Sin(s.heading) + s.rng.NormFloat64()*magNoise,
+		earthFieldZ + s.rng.NormFloat64()*magNoise,
+	}
+	temp := 35 - 10*math.Exp(-now.Sub(s.started).Minutes()/5)
+
+	// Round to the resolution the board reports
+	round := func(v float64, digits int) float64 {
+		scale := math.Pow10(digits)
+		return math.Round(v*scale) / scale
+	}
+	for i := range acc {
+		acc[i] = round(acc[i], 3)
+		gyro[i] = round(gyro[i], 2)
+		mag[i] = round(mag[i], 1)
+	}
+
+	frame, err := EncodePacket(s.cfg.Format, Packet{
+		DeviceID:     s.cfg.DeviceID,
+		Seq:          s.seq,
+		HasSeq:       true,
+		Time:         now.In(deviceLocation).Format("15:04:05"),
+		DeviceTime:   now,
+		Latitude:     round(lat, 6),
+		Longitude:    round(lon, 6),
+		Satellites:   s.satellites,
+		Altitude:     round(altitude, 1),
+		Speed:        round(s.cfg.Speed*3.6, 2),
+		Course:       round(course, 1),
+		HDOP:         round(hdop, 2),
+		PDOP:         round(hdop*1.4, 2),
+		Fix:          fix,
+		GNSS:         HasAltitude | HasSpeed | HasCourse | HasHDOP | HasPDOP | HasFix,
+		Acceleration: acc,
+		Gyro:         gyro,
+		Magnetometer: mag,
+		Temperature:  round(temp, 1),
+		IMU:          HasGyro | HasMagnetometer | HasTemperature,
+		Checksum:     s.cfg.Checksum,
+	})
+	if err != nil {
+		log.Println("simulator:", err)
+		return "", false
+	}
+
+	if s.rng.Float64() < s.cfg.CorruptRate {
+		// Keep the line ending or frame delimiter so only this packet is lost
+		body := bytes.TrimRight(frame, "\r\n\x00")
+		return s.corrupt(string(body)) + string(frame[len(body):]), true
+	}
+	return string(frame), true
+}
+
+// move advances the position along the track or by a random walk
+func (s *Simulator) move(dt float64) {
+	dist := s.cfg.Speed * dt
+	prev := s.heading
+	defer func() {
+		if dt > 0 {
+			turn := math.Remainder(s.heading-prev, 2*math.Pi)
+			s.turnRate = turn / dt
+		}
+	}()
+
+	if len(s.cfg.Track) > 1 {
+		target := s.cfg.Track[s.waypoint]
+		dy := (target.Latitude - s.lat) * metersPerDegree
+		dx := (target.Longitude - s.lon) * metersPerDegree * math.Cos(s.lat*math.Pi/180)
+		remaining := math.Hypot(dx, dy)
+		if remaining <= dist {
+			s.lat, s.lon = target.Latitude, target.Longitude
+			s.waypoint = (s.waypoint + 1) % len(s.cfg.Track)
+			return
+		}
+		s.heading = math.Atan2(dx, dy)
+	} else {
+		s.heading += s.rng.NormFloat64() * 0.1
+	}
+
+	s.lat += dist * math.Cos(s.heading) / metersPerDegree
+	s.lon += dist * math.Sin(s.heading) / (metersPerDegree * math.Cos(s.lat*math.Pi/180))
+}
+
+// updateSatellites drifts the satellite count and simulates outages
+func (s *Simulator) updateSatellites(now time.Time, dt float64) {
+	if now.Before(s.outageUntil) {
+		s.satellites = s.rng.IntN(3)
+		return
+	}
+	if s.rng.Float64() < s.cfg.OutageRate*dt {
+		s.outageUntil = now.Add(s.cfg.OutageTime)
+		s.satellites = 0
+		return
+	}
+
+	if s.satellites < 4 {
+		s.satellites = 6
+	}
+	if s.rng.Float64() < 0.05 {
+		s.satellites += s.rng.IntN(3) - 1
+		s.satellites = max(4, min(14, s.satellites))
+	}
+}
+
+// corrupt damages a line the way a noisy link does: a flipped bit or a
+// truncated packet
+func (s *Simulator) corrupt(line string) string {
+	b := []byte(line)
+	if s.rng.IntN(2) == 0 {
+		i := s.rng.IntN(len(b))
+		b[i] ^= 1 << s.rng.IntN(7)
+		return string(b)
+	}
+	return string(b[:s.rng.IntN(len(b))])
+}
+
+// LoadTrack reads a scripted track with one "latitude,longitude" pair per
+// line; empty lines and lines starting with # are ignored
+func LoadTrack(path string) ([]TrackPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open track: %w", err)
+	}
+	defer f.Close()
+
+	var track []TrackPoint
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		latStr, lonStr, ok := strings.Cut(line, ",")
+		if !ok {
+			return nil, fmt.Errorf("track line %d: expected latitude,longitude", n)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("track line %d: %w", n, err)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("track line %d: %w", n, err)
+		}
+		track = append(track, TrackPoint{Latitude: lat, Longitude: lon})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read track: %w", err)
+	}
+	return track, nil
+}
+
+// StartSimulator creates a pseudo-terminal and streams simulated packets
+// into it; the returned path can be opened like a serial port and the
+// returned function stops the simulator
+func StartSimulator(cfg SimulatorConfig) (string, func(), error) {
+	if cfg.Rate <= 0 {
+		return "", nil, fmt.Errorf("invalid simulator rate %g", cfg.Rate)
+	}
+
+	master, slave, err := openPTY()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Keep the slave side open ourselves so the pty does not hang up when
+	// the app closes and reopens the port
+	hold, err := os.OpenFile(slave, os.O_RDWR, 0)
+	if err != nil {
+		master.Close()
+		return "", nil, fmt.Errorf("failed to open %s: %w", slave, err)
+	}
+
+	// Commands written by the app arrive on the master side
+	cmds := make(chan string, 8)
+	go func() {
+		scanner := bufio.NewScanner(master)
+		scanner.Split(scanCommandLines)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				cmds <- line
+			}
+		}
+	}()
+
+	stop := make(chan struct{})
+	go func() {
+		if err := NewSimulator(cfg).Run(master, cmds, stop); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	stopFn := func() {
+		close(stop)
+		hold.Close()
+		master.Close()
+	}
+	return slave, stopFn, nil
+}
+
+// scanCommandLines splits commands terminated by CR, LF or CRLF
+func scanCommandLines(data []byte, atEOF bool) (int, []byte, error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PacketSource is a transport delivering the device byte stream; the
+// stream is decoded according to the source's Protocol
+type PacketSource interface {
+	// Name identifies the source in the log and header
+	Name() string
+	// Open connects to the source and returns its byte stream
+	Open() (io.ReadCloser, error)
+	// Persistent reports whether the source should be reopened with
+	// backoff after its stream fails or ends
+	Persistent() bool
+}
+
+// SourceEvent is one line received from a source
+type SourceEvent struct {
+	Raw    string
+	Time   time.Time // host receive time
+	Packet Packet
+	Err    error // parse error; Packet is only valid when Err is nil
+	// Fragment marks valid data that does not complete a packet by
+	// itself, such as an NMEA satellites-in-view sentence
+	Fragment bool
+	// Binary marks Raw as a binary frame rather than a text line
+	Binary bool
+	// Response marks data that failed to decode as a device reply to a
+	// console command rather than damaged telemetry
+	Response bool
+
+	// line is Raw before it is copied out of the decoder's buffer, which
+	// is only valid until the decoder is called again
+	line []byte
+}
+
+// fillRaw copies the line into Raw if the decoder left it in its buffer
+func (ev *SourceEvent) fillRaw() {
+	if ev.line != nil {
+		ev.Raw = string(ev.line)
+		ev.line = nil
+	}
+}
+
+const dialTimeout = 5 * time.Second
+
+// errSourceClosed is returned by streams that were closed by the manager
+var errSourceClosed = errors.New("source closed")
+
+// ParseSourceSpec creates a non-serial source from a command line spec:
+// tcp://host:port, udp://[host]:port, file://path, replay://path or stdin
+func ParseSourceSpec(spec string) (PacketSource, error) {
+	switch {
+	case strings.HasPrefix(spec, "tcp://"):
+		return &TCPSource{Addr: strings.TrimPrefix(spec, "tcp://")}, nil
+	case strings.HasPrefix(spec, "udp://"):
+		return &UDPSource{Addr: strings.TrimPrefix(spec, "udp://")}, nil
+	case strings.HasPrefix(spec, "replay://"):
+		src, err := NewReplaySource(strings.TrimPrefix(spec, "replay://"))
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	case strings.HasPrefix(spec, "file://"):
+		return &FileSource{Path: strings.TrimPrefix(spec, "file://")}, nil
+	case spec == "stdin" || spec == "-":
+		return StdinSource{}, nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", spec)
+	}
+}
+
+// readSource decodes a stream with the given protocol, calling emit for
+// every line or frame until the stream fails. Raw is always set for
+// errors; for valid packets only while keepRaw reports true, since copying
+// every line is the main cost of reading text packets
+func readSource(stream io.Reader, proto Protocol, keepRaw func() bool, emit func(SourceEvent)) error {
+	dec := NewDecoder(proto, stream)
+	// A device sending a time it cannot be read from does so in every
+	// packet, so it is only logged once per device
+	badTime := make(map[string]bool)
+	for {
+		ev, err := dec.Next()
+		if err != nil {
+			return err
+		}
+		if ev.Err == nil && !ev.Fragment {
+			if err := stampPacket(&ev.Packet, ev.Time); err != nil && !badTime[ev.Packet.DeviceID] {
+				badTime[ev.Packet.DeviceID] = true
+				log.Printf("device time of %s: %v; further failures are not logged", ev.Packet.DeviceID, err)
+			}
+			packetValidator.Apply(&ev)
+		}
+		if keepRaw() {
+			ev.fillRaw()
+		}
+		ev.line = nil
+		emit(ev)
+	}
+}
+
+// TCPSource connects to a network bridge that forwards the serial stream
+type TCPSource struct {
+	Addr string
+}
+
+func (s *TCPSource) Name() string     { return "tcp://" + s.Addr }
+func (s *TCPSource) Persistent() bool { return true }
+
+func (s *TCPSource) Open() (io.ReadCloser, error) {
+	conn, err := net.DialTimeout("tcp", s.Addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.Addr, err)
+	}
+	return conn, nil
+}
+
+// UDPSource listens for datagrams, each holding one or more lines
+type UDPSource struct {
+	Addr string
+}
+
+func (s *UDPSource) Name() string     { return "udp://" + s.Addr }
+func (s *UDPSource) Persistent() bool { return true }
+
+func (s *UDPSource) Open() (io.ReadCloser, error) {
+	conn, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.Addr, err)
+	}
+	return &datagramReader{conn: conn, buf: make([]byte, 65536)}, nil
+}
+
+// datagramReader turns datagrams into a line stream, terminating each
+// datagram with a newline so packets never run together
+type datagramReader struct {
+	conn    net.PacketConn
+	buf     []byte
+	pending []byte
+}
+
+func (r *datagramReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		n, _, err := r.conn.ReadFrom(r.buf)
+		if err != nil {
+			return 0, err
+		}
+		r.pending = r.buf[:n]
+		if n > 0 && r.pending[n-1] != '\n' {
+			r.pending = append(r.pending, '\n')
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *datagramReader) Close() error {
+	return r.conn.Close()
+}
+
+// FileSource reads a text file of recorded lines once
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Name() string     { return "file://" + s.Path }
+func (s *FileSource) Persistent() bool { return false }
+
+func (s *FileSource) Open() (io.ReadCloser, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.Path, err)
+	}
+	return f, nil
+}
+
+// StdinSource reads lines piped into the application
+type StdinSource struct{}
+
+func (StdinSource) Name() string     { return "stdin" }
+func (StdinSource) Persistent() bool { return false }
+
+func (StdinSource) Open() (io.ReadCloser, error) {
+	// Closing stdin would break a later reopen, and a read blocked on it
+	// cannot be interrupted. A single goroutine reads stdin for the whole
+	// process and each open gets a pipe that Close can unblock
+	stdinOnce.Do(func() { go pumpStdin() })
+	pr, pw := io.Pipe()
+	s := &stdinStream{PipeReader: pr, closed: make(chan struct{})}
+	go s.forward(pw)
+	return s, nil
+}
+
+var (
+	stdinOnce   sync.Once
+	stdinChunks = make(chan []byte)
+	stdinErr    error // set before stdinChunks is closed
+
+	// Data read from stdin but not consumed before the last stream closed
+	stdinLeftMu sync.Mutex
+	stdinLeft   []byte
+)
+
+// pumpStdin reads stdin until it fails, handing every chunk to the open
+// stream
+func pumpStdin() {
+	for {
+		buf := make([]byte, 4096)
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			stdinChunks <- buf[:n]
+		}
+		if err != nil {
+			stdinErr = err
+			close(stdinChunks)
+			return
+		}
+	}
+}
+
+// stdinStream is one open of stdin
+type stdinStream struct {
+	*io.PipeReader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *stdinStream) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return s.PipeReader.Close()
+}
+
+// forward copies stdin into the pipe until the stream is closed, keeping
+// what the reader did not take for the next open
+func (s *stdinStream) forward(pw *io.PipeWriter) {
+	stdinLeftMu.Lock()
+	chunk := stdinLeft
+	stdinLeft = nil
+	stdinLeftMu.Unlock()
+
+	for {
+		if len(chunk) > 0 {
+			n, err := pw.Write(chunk)
+			if err != nil {
+				stdinLeftMu.Lock()
+				stdinLeft = chunk[n:]
+				stdinLeftMu.Unlock()
+				return
+			}
+		}
+
+		var ok bool
+		select {
+		case chunk, ok = <-stdinChunks:
+			if !ok {
+				pw.CloseWithError(stdinErr)
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/tarm/serial"
+)
+
+// SerialSource reads from a serial device, following it across unplugs
+// and /dev renames
+type SerialSource struct {
+	Device   PortInfo
+	Settings SerialSettings
+}
+
+// NewSerialSource validates the settings and captures the USB identity of
+// the named port so it can be found again after a reconnect
+func NewSerialSource(name string, settings SerialSettings) (*SerialSource, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no port selected")
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	device := PortInfo{Path: name}
+	if ports, err := ListPorts(); err == nil {
+		if p, ok := FindPort(ports, name); ok {
+			device = p
+		}
+	}
+	return &SerialSource{Device: device, Settings: settings}, nil
+}
+
+func (s *SerialSource) Name() string {
+	return filepath.Base(s.Device.Path) + " @ " + s.Settings.String()
+}
+
+func (s *SerialSource) Persistent() bool { return true }
+
+// Protocol returns the wire protocol chosen for the port
+func (s *SerialSource) Protocol() Protocol { return s.Settings.WireProtocol() }
+
+func (s *SerialSource) Open() (io.ReadCloser, error) {
+	path, ok := resolveDevice(s.Device)
+	if !ok {
+		return nil, errDeviceLost
+	}
+	port, err := openSerial(path, s.Settings)
+	if err != nil {
+		return nil, err
+	}
+	return &serialStream{port: port, path: path}, nil
+}
+
+// openSerial opens a port with validated settings
+func openSerial(name string, settings SerialSettings) (*serial.Port, error) {
+	port, err := serial.OpenPort(settings.serialConfig(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return port, nil
+}
+
+// serialStream hides read timeouts from the line reader: the driver
+// reports a timeout as EOF, which is retried unless the port has
+// disappeared or the stream was closed
+type serialStream struct {
+	port   *serial.Port
+	path   string
+	closed atomic.Bool
+}
+
+func (s *serialStream) Read(p []byte) (int, error) {
+	for {
+		n, err := s.port.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if s.closed.Load() {
+			return 0, errSourceClosed
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if !portPresent(s.path) {
+			return 0, errDeviceLost
+		}
+	}
+}
+
+// Write sends bytes to the device
+func (s *serialStream) Write(p []byte) (int, error) {
+	return s.port.Write(p)
+}
+
+func (s *serialStream) Close() error {
+	s.closed.Store(true)
+	return s.port.Close()
+}
+
+// resolveDevice finds the current device node for a previously opened
+// device, matching on USB serial number or by-id link when available
+func resolveDevice(device PortInfo) (string, bool) {
+	ports, err := ListPorts()
+	if err != nil {
+		return "", false
+	}
+
+	for _, p := range ports {
+		switch {
+		case device.SerialNumber != "":
+			if p.SerialNumber == device.SerialNumber && p.VID == device.VID && p.PID == device.PID {
+				return p.Path, true
+			}
+		case device.ByID != "":
+			if p.ByID == device.ByID {
+				return p.Path, true
+			}
+		case p.Path == device.Path:
+			return p.Path, true
+		}
+	}
+
+	// Ports that are not USB devices are not listed; fall back to the node
+	if device.VID == "" && portPresent(device.Path) {
+		return device.Path, true
+	}
+	return "", false
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Spool is an append-only file of packets that could not be written to
+// the database, one JSON object per line. The offset of the first packet
+// not yet replayed is kept next to it in "<path>.pos", so a restart
+// resumes where the last replay stopped
+type Spool struct {
+	path    string
+	file    *os.File
+	size    int64 // bytes in the file
+	pos     int64 // offset of the first packet not replayed
+	backlog int   // packets after pos
+}
+
+// OpenSpool opens or creates the spool file and counts its backlog
+func OpenSpool(path string) (*Spool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool: %w", err)
+	}
+	s := &Spool{path: path, file: f}
+
+	if raw, err := os.ReadFile(s.posPath()); err == nil {
+		if pos, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64); err == nil && pos > 0 {
+			s.pos = pos
+		}
+	}
+
+	// Count the lines after pos and find the end of the last complete one
+	var offset, end int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		for i, c := range buf[:n] {
+			if c == '\n' {
+				end = offset + int64(i) + 1
+				if end > s.pos {
+					s.backlog++
+				}
+			}
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read spool: %w", err)
+		}
+	}
+
+	// A crash can leave half a line at the end; drop it
+	if end < offset {
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to repair spool: %w", err)
+		}
+	}
+	s.size = end
+	if s.pos > s.size {
+		s.pos, s.backlog = 0, 0
+	}
+	return s, nil
+}
+
+func (s *Spool) posPath() string { return s.path + ".pos" }
+
+// Backlog returns the number of packets waiting to be replayed
+func (s *Spool) Backlog() int { return s.backlog }
+
+// Size returns the size of the spool file in bytes
+func (s *Spool) Size() int64 { return s.size }
+
+// Append stores packets at the end of the spool and syncs the file.
+// Packets that cannot be encoded are left out and counted in skipped
+func (s *Spool) Append(packets []Packet) (skipped int, err error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, p := range packets {
+		// Encode writes nothing when it fails
+		if err := enc.Encode(p); err != nil {
+			log.Printf("Not spooling packet %s/%d: %v", p.DeviceID, p.Seq, err)
+			skipped++
+		}
+	}
+	if buf.Len() == 0 {
+		return skipped, nil
+	}
+
+	if _, err := s.file.WriteAt(buf.Bytes(), s.size); err != nil {
+		return skipped, fmt.Errorf("failed to write spool: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return skipped, fmt.Errorf("failed to sync spool: %w", err)
+	}
+	s.size += int64(buf.Len())
+	s.backlog += len(packets) - skipped
+	return skipped, nil
+}
+
+// SpoolMark is a position in the spool up to which records can be
+// committed
+type SpoolMark struct {
+	offset  int64
+	records int // records before offset not yet committed
+}
+
+// Peek reads up to n of the oldest records without removing them. marks[i]
+// follows packets[i] and end follows every record read, corrupt ones that
+// were skipped included; Commit one of them once the packets before it are
+// stored
+func (s *Spool) Peek(n int) (packets []Packet, marks []SpoolMark, end SpoolMark, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.pos, s.size-s.pos))
+	end.offset = s.pos
+	packets = make([]Packet, 0, min(n, s.backlog))
+	for end.records < n {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, SpoolMark{}, fmt.Errorf("failed to read spool: %w", err)
+		}
+		var p Packet
+		decodeErr := json.Unmarshal(line, &p)
+		if decodeErr != nil {
+			log.Printf("Skipping corrupt spool record at byte %d: %v", end.offset, decodeErr)
+		}
+		end.offset += int64(len(line))
+		end.records++
+		if decodeErr == nil {
+			packets = append(packets, p)
+			marks = append(marks, end)
+		}
+	}
+	return packets, marks, end, nil
+}
+
+// Commit removes the records before a mark returned by Peek; the file is
+// emptied once everything has been replayed
+func (s *Spool) Commit(mark SpoolMark) error {
+	s.pos = mark.offset
+	s.backlog -= mark.records
+	if s.pos >= s.size {
+		if err := s.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate spool: %w", err)
+		}
+		s.size, s.pos, s.backlog = 0, 0, 0
+		if err := os.Remove(s.posPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to reset spool position: %w", err)
+		}
+		return nil
+	}
+
+	tmp := s.posPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(s.pos, 10)), 0o644); err != nil {
+		return fmt.Errorf("failed to save spool position: %w", err)
+	}
+	if err := os.Rename(tmp, s.posPath()); err != nil {
+		return fmt.Errorf("failed to save spool position: %w", err)
+	}
+	return nil
+}
+
+// Close closes the spool file
+func (s *Spool) Close() error {
+	return s.file.Close()
+}
+
+// getSpoolPath returns the spool location, overridable with DB_SPOOL
+func getSpoolPath() string {
+	if path := os.Getenv("DB_SPOOL"); path != "" {
+		return path
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "packets.spool"
+	}
+	return filepath.Join(dir, "komkomunikacijos", "packets.spool")
+}
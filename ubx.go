@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+)
+
+// UBX frame layout: 0xB5 0x62, class, id, little-endian payload length,
+// payload, then an 8-bit Fletcher checksum over class..payload
+const (
+	ubxSync1 = 0xB5
+	ubxSync2 = 0x62
+
+	ubxHeaderLen   = 6
+	ubxMaxPayload  = 4096 // larger lengths are corrupt headers
+	ubxMaxGarbage  = 256  // bytes of junk reported per event while resyncing
+	ubxClassNAV    = 0x01
+	ubxIDNavDOP    = 0x04
+	ubxIDNavPVT    = 0x07
+	ubxIDNavSAT    = 0x35
+	ubxNavPVTLen   = 92
+	ubxNavDOPLen   = 18
+	ubxNavSATBlock = 12
+)
+
+// ChecksumFletcher marks packets decoded from checksummed binary frames
+const ChecksumFletcher ChecksumStatus = "fletcher"
+
+var (
+	errUBXSync   = errors.New("no UBX sync")
+	errUBXLength = errors.New("implausible UBX payload length")
+)
+
+// ubxChecksum computes the 8-bit Fletcher checksum of class..payload
+func ubxChecksum(data []byte) (a, b byte) {
+	for _, c := range data {
+		a += c
+		b += a
+	}
+	return a, b
+}
+
+// ubxDecoder frames a UBX byte stream and assembles NAV messages into
+// packets; NAV-PVT completes a packet, NAV-DOP and NAV-SAT add to it
+type ubxDecoder struct {
+	reader *bufio.Reader
+	state  Packet
+}
+
+func newUBXDecoder(stream io.Reader) *ubxDecoder {
+	return &ubxDecoder{reader: bufio.NewReader(stream)}
+}
+
+func (d *ubxDecoder) Next() (SourceEvent, error) {
+	frame, err := d.readFrame()
+	if len(frame) == 0 {
+		return SourceEvent{}, err
+	}
+
+	ev := SourceEvent{Raw: string(frame), Time: time.Now(), Binary: true}
+	if err != nil {
+		// A bad frame; the stream itself is still usable
+		ev.Err = err
+		ev.Response = errors.Is(err, errUBXSync) && isTextReply(ev.Raw)
+		return ev, nil
+	}
+
+	var complete bool
+	ev.Packet, complete, ev.Err = d.decode(frame, ev.Time)
+	ev.Fragment = ev.Err == nil && !complete
+	return ev, nil
+}
+
+// readFrame returns the next checksum-verified frame. Junk before a sync
+// pattern and frames failing validation are returned together with a
+// *ParseError; a nil frame means the stream failed
+func (d *ubxDecoder) readFrame() ([]byte, error) {
+	var junk []byte
+	for {
+		if sync, _ := d.reader.Peek(2); len(sync) == 2 && sync[0] == ubxSync1 && sync[1] == ubxSync2 {
+			if len(junk) > 0 {
+				return junk, &ParseError{Kind: ParseFormat, Line: string(junk), Err: errUBXSync}
+			}
+			d.reader.Discard(1)
+			break
+		}
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			if len(junk) > 0 {
+				return junk, &ParseError{Kind: ParseFormat, Line: string(junk), Err: errUBXSync}
+			}
+			return nil, err
+		}
+		junk = append(junk, c)
+		// Device replies are text lines between frames
+		if c == '\n' && isTextReply(string(junk)) {
+			return junk, &ParseError{Kind: ParseFormat, Line: string(junk), Err: errUBXSync}
+		}
+		if len(junk) >= ubxMaxGarbage {
+			return junk, &ParseError{Kind: ParseFormat, Line: string(junk), Err: errUBXSync}
+		}
+	}
+
+	frame := make([]byte, ubxHeaderLen, ubxHeaderLen+64)
+	frame[0] = ubxSync1
+	if _, err := io.ReadFull(d.reader, frame[1:]); err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint16(frame[4:6]))
+	if length > ubxMaxPayload {
+		return frame, &ParseError{Kind: ParseOutOfRange, Field: "length", Value: fmt.Sprint(length),
+			Offset: 4, Line: string(frame), Err: errUBXLength}
+	}
+
+	frame = append(frame, make([]byte, length+2)...)
+	if _, err := io.ReadFull(d.reader, frame[ubxHeaderLen:]); err != nil {
+		return nil, err
+	}
+
+	end := len(frame) - 2
+	a, b := ubxChecksum(frame[2:end])
+	if a != frame[end] || b != frame[end+1] {
+		return frame, &ParseError{Kind: ParseChecksum, Field: "checksum", Value: fmt.Sprintf("%02X%02X", frame[end], frame[end+1]),
+			Offset: end, Line: string(frame), Err: fmt.Errorf("%w: got %02X%02X", ErrChecksum, a, b)}
+	}
+	return frame, nil
+}
+
+// decode interprets a verified frame
+func (d *ubxDecoder) decode(frame []byte, received time.Time) (Packet, bool, error) {
+	class, id := frame[2], frame[3]
+	payload := frame[ubxHeaderLen : len(frame)-2]
+	if class != ubxClassNAV {
+		return Packet{}, false, nil
+	}
+
+	switch id {
+	case ubxIDNavPVT:
+		if len(payload) < ubxNavPVTLen {
+			return Packet{}, false, ubxTruncated("NAV-PVT", frame)
+		}
+		d.navPVT(payload)
+		p := d.state
+		p.DeviceID = "UBX"
+		p.Checksum = ChecksumFletcher
+		p.Extra = maps.Clone(d.state.Extra)
+		return p, true, nil
+	case ubxIDNavDOP:
+		if len(payload) < ubxNavDOPLen {
+			return Packet{}, false, ubxTruncated("NAV-DOP", frame)
+		}
+		d.navDOP(payload)
+	case ubxIDNavSAT:
+		if len(payload) < 8 || len(payload) < 8+int(payload[5])*ubxNavSATBlock {
+			return Packet{}, false, ubxTruncated("NAV-SAT", frame)
+		}
+		d.navSAT(payload)
+	}
+	return Packet{}, false, nil
+}
+
+func ubxTruncated(msg string, frame []byte) error {
+	return &ParseError{Kind: ParseTruncated, Field: msg, Offset: ubxHeaderLen, Line: string(frame),
+		Err: fmt.Errorf("payload of %d bytes", len(frame)-ubxHeaderLen-2)}
+}
+
+// navPVT reads the navigation solution: time, position, velocity, fix
+func (d *ubxDecoder) navPVT(b []byte) {
+	le := binary.LittleEndian
+	p := &d.state
+
+	valid := b[11]
+	if valid&0x03 == 0x03 { // validDate and validTime
+		t := time.Date(int(le.Uint16(b[4:])), time.Month(b[6]), int(b[7]),
+			int(b[8]), int(b[9]), int(b[10]), 0, time.UTC)
+		t = t.Add(time.Duration(int32(le.Uint32(b[16:]))))
+		p.DeviceTime = t
+		p.Time = t.Format("15:04:05.000")
+	} else {
+		p.DeviceTime = time.Time{}
+		p.Time = ""
+	}
+
+	fixOK := b[21]&0x01 != 0
+	switch fix := b[20]; {
+	case !fixOK || fix < 2 || fix > 4:
+		p.Fix = FixNone
+	case fix == 2:
+		p.Fix = Fix2D
+	default:
+		p.Fix = Fix3D
+	}
+	p.GNSS |= HasFix
+
+	p.Satellites = int(b[23])
+	if fixOK {
+		p.Longitude = float64(int32(le.Uint32(b[24:]))) * 1e-7
+		p.Latitude = float64(int32(le.Uint32(b[28:]))) * 1e-7
+		p.Altitude = float64(int32(le.Uint32(b[36:]))) / 1000
+		p.GNSS |= HasAltitude
+	} else {
+		p.Latitude, p.Longitude = 0, 0
+		p.GNSS &^= HasAltitude
+	}
+
+	p.Speed = float64(int32(le.Uint32(b[60:]))) * 0.0036 // mm/s to km/h
+	p.Course = float64(int32(le.Uint32(b[64:]))) * 1e-5
+	p.PDOP = float64(le.Uint16(b[76:])) * 0.01
+	p.GNSS |= HasSpeed | HasCourse | HasPDOP
+
+	d.setExtra("HAcc", float64(le.Uint32(b[40:]))/1000) // m
+	d.setExtra("VAcc", float64(le.Uint32(b[44:]))/1000)
+}
+
+// navDOP reads the dilution of precision values
+func (d *ubxDecoder) navDOP(b []byte) {
+	le := binary.LittleEndian
+	d.state.PDOP = float64(le.Uint16(b[6:])) * 0.01
+	d.state.HDOP = float64(le.Uint16(b[12:])) * 0.01
+	d.state.GNSS |= HasPDOP | HasHDOP
+}
+
+// navSAT counts the satellites tracked and those used in the solution
+func (d *ubxDecoder) navSAT(b []byte) {
+	n := int(b[5])
+	used := 0
+	for i := 0; i < n; i++ {
+		flags := binary.LittleEndian.Uint32(b[8+i*ubxNavSATBlock+8:])
+		if flags&0x08 != 0 { // svUsed
+			used++
+		}
+	}
+	d.setExtra("SatellitesInView", int64(n))
+	d.setExtra("SatellitesUsed", int64(used))
+}
+
+func (d *ubxDecoder) setExtra(name string, value any) {
+	if d.state.Extra == nil {
+		d.state.Extra = make(map[string]any)
+	}
+	d.state.Extra[name] = value
+}
+
+// scanUBX counts the frames in a capture and how many of them pass the
+// checksum, returning the incomplete tail; used by auto-detection
+func scanUBX(data []byte) (frames, valid int, rest []byte) {
+	for {
+		i := 0
+		for i+1 < len(data) && !(data[i] == ubxSync1 && data[i+1] == ubxSync2) {
+			i++
+		}
+		data = data[i:]
+		if len(data) < ubxHeaderLen {
+			return frames, valid, data
+		}
+
+		length := int(binary.LittleEndian.Uint16(data[4:6]))
+		if length > ubxMaxPayload {
+			frames++
+			data = data[2:]
+			continue
+		}
+		end := ubxHeaderLen + length
+		if len(data) < end+2 {
+			return frames, valid, data
+		}
+
+		frames++
+		if a, b := ubxChecksum(data[2:end]); a == data[end] && b == data[end+1] {
+			valid++
+			data = data[end+2:]
+		} else {
+			data = data[2:]
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ValidationMode decides what happens to packets outside the limits
+type ValidationMode string
+
+const (
+	// ValidationLenient keeps invalid packets but flags them as suspect
+	ValidationLenient ValidationMode = "lenient"
+	// ValidationStrict rejects invalid packets like parse failures
+	ValidationStrict ValidationMode = "strict"
+)
+
+// ErrOutOfLimits marks packets that parsed but fail physical validation
+var ErrOutOfLimits = errors.New("outside validation limits")
+
+// ErrNonFinite marks NaN and infinite values, which cannot be stored
+var ErrNonFinite = errors.New("not a finite number")
+
+// FieldLimit is an inclusive range for one field
+type FieldLimit struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// ValidationLimits holds the accepted range of every validated field
+type ValidationLimits struct {
+	Latitude     FieldLimit `json:"latitude"`
+	Longitude    FieldLimit `json:"longitude"`
+	Satellites   FieldLimit `json:"satellites"`
+	Altitude     FieldLimit `json:"altitude"`     // metres
+	Speed        FieldLimit `json:"speed"`        // km/h
+	Course       FieldLimit `json:"course"`       // degrees
+	DOP          FieldLimit `json:"dop"`          // HDOP and PDOP
+	Acceleration FieldLimit `json:"acceleration"` // per axis, in g
+	Gyro         FieldLimit `json:"gyro"`         // per axis, in °/s
+	Magnetometer FieldLimit `json:"magnetometer"` // per axis, in µT
+	Temperature  FieldLimit `json:"temperature"`  // °C
+}
+
+// DefaultValidationLimits returns limits any real fix and a ±16 g
+// accelerometer satisfy
+func DefaultValidationLimits() ValidationLimits {
+	return ValidationLimits{
+		Latitude:     FieldLimit{Min: -90, Max: 90},
+		Longitude:    FieldLimit{Min: -180, Max: 180},
+		Satellites:   FieldLimit{Min: 0, Max: 64},
+		Altitude:     FieldLimit{Min: -500, Max: 20000},
+		Speed:        FieldLimit{Min: 0, Max: 1500},
+		Course:       FieldLimit{Min: 0, Max: 360},
+		DOP:          FieldLimit{Min: 0, Max: 100},
+		Acceleration: FieldLimit{Min: -16, Max: 16},
+		Gyro:         FieldLimit{Min: -2000, Max: 2000},
+		Magnetometer: FieldLimit{Min: -4900, Max: 4900},
+		Temperature:  FieldLimit{Min: -40, Max: 125},
+	}
+}
+
+// LoadValidationLimits reads limits from a JSON file; fields missing from
+// the file keep their defaults and an empty path yields the defaults
+func LoadValidationLimits(path string) (ValidationLimits, error) {
+	limits := DefaultValidationLimits()
+	if path == "" {
+		return limits, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return limits, fmt.Errorf("failed to read validation limits: %w", err)
+	}
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return limits, fmt.Errorf("failed to parse validation limits: %w", err)
+	}
+	return limits, nil
+}
+
+// Validator checks parsed packets against physical limits
+type Validator struct {
+	Mode   ValidationMode
+	Limits ValidationLimits
+}
+
+// NewValidator creates a validator, rejecting unknown modes
+func NewValidator(mode string, limits ValidationLimits) (*Validator, error) {
+	switch m := ValidationMode(mode); m {
+	case ValidationLenient, ValidationStrict:
+		return &Validator{Mode: m, Limits: limits}, nil
+	default:
+		return nil, fmt.Errorf("unknown validation mode %q", mode)
+	}
+}
+
+// packetValidator is applied to every packet read from a source
+var packetValidator = &Validator{Mode: ValidationLenient, Limits: DefaultValidationLimits()}
+
+// Check returns a *ParseError wrapping ErrOutOfLimits for the first field
+// outside its limits; NaN and infinities are never valid
+func (v *Validator) Check(p Packet) error {
+	if err := checkField("Latitude", p.Latitude, v.Limits.Latitude); err != nil {
+		return err
+	}
+	if err := checkField("Longitude", p.Longitude, v.Limits.Longitude); err != nil {
+		return err
+	}
+	if err := checkField("Satellites", float64(p.Satellites), v.Limits.Satellites); err != nil {
+		return err
+	}
+	optional := []struct {
+		name  string
+		field GNSSFields
+		value float64
+		limit FieldLimit
+	}{
+		{"Altitude", HasAltitude, p.Altitude, v.Limits.Altitude},
+		{"Speed", HasSpeed, p.Speed, v.Limits.Speed},
+		{"Course", HasCourse, p.Course, v.Limits.Course},
+		{"HDOP", HasHDOP, p.HDOP, v.Limits.DOP},
+		{"PDOP", HasPDOP, p.PDOP, v.Limits.DOP},
+	}
+	for _, o := range optional {
+		if !p.GNSS.Has(o.field) {
+			continue
+		}
+		if err := checkField(o.name, o.value, o.limit); err != nil {
+			return err
+		}
+	}
+	for _, a := range p.Acceleration {
+		if err := checkField("Acceleration", a, v.Limits.Acceleration); err != nil {
+			return err
+		}
+	}
+	if p.IMU.Has(HasGyro) {
+		for _, g := range p.Gyro {
+			if err := checkField("Gyro", g, v.Limits.Gyro); err != nil {
+				return err
+			}
+		}
+	}
+	if p.IMU.Has(HasMagnetometer) {
+		for _, m := range p.Magnetometer {
+			if err := checkField("Magnetometer", m, v.Limits.Magnetometer); err != nil {
+				return err
+			}
+		}
+	}
+	if p.IMU.Has(HasTemperature) {
+		if err := checkField("Temperature", p.Temperature, v.Limits.Temperature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkField(name string, value float64, limit FieldLimit) error {
+	if isFinite(value) && value >= limit.Min && value <= limit.Max {
+		return nil
+	}
+	return &ParseError{
+		Kind:   ParseOutOfRange,
+		Field:  name,
+		Value:  strconv.FormatFloat(value, 'g', -1, 64),
+		Offset: -1,
+		Err:    fmt.Errorf("%w [%g, %g]", ErrOutOfLimits, limit.Min, limit.Max),
+	}
+}
+
+// checkFinite returns a *ParseError wrapping ErrNonFinite for the first
+// NaN or infinite value, Extra fields included
+func checkFinite(p Packet) error {
+	type value struct {
+		name string
+		v    float64
+	}
+	// An array rather than a slice keeps this off the heap
+	values := [...]value{
+		{"Latitude", p.Latitude}, {"Longitude", p.Longitude}, {"Altitude", p.Altitude},
+		{"Speed", p.Speed}, {"Course", p.Course}, {"HDOP", p.HDOP}, {"PDOP", p.PDOP},
+		{"Temperature", p.Temperature},
+		{"Acceleration", p.Acceleration[0]}, {"Acceleration", p.Acceleration[1]}, {"Acceleration", p.Acceleration[2]},
+		{"Gyro", p.Gyro[0]}, {"Gyro", p.Gyro[1]}, {"Gyro", p.Gyro[2]},
+		{"Magnetometer", p.Magnetometer[0]}, {"Magnetometer", p.Magnetometer[1]}, {"Magnetometer", p.Magnetometer[2]},
+	}
+	for _, f := range values {
+		if !isFinite(f.v) {
+			return nonFiniteError(f.name, f.v)
+		}
+	}
+
+	for name, extra := range p.Extra {
+		items := []any{extra}
+		if list, ok := extra.([]any); ok {
+			items = list
+		}
+		for _, item := range items {
+			if f, ok := item.(float64); ok && !isFinite(f) {
+				return nonFiniteError(name, f)
+			}
+		}
+	}
+	return nil
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func nonFiniteError(name string, value float64) error {
+	return &ParseError{
+		Kind:   ParseBadNumber,
+		Field:  name,
+		Value:  strconv.FormatFloat(value, 'g', -1, 64),
+		Offset: -1,
+		Err:    ErrNonFinite,
+	}
+}
+
+// Apply validates a successfully parsed event: in strict mode an invalid
+// packet becomes an error, in lenient mode it is marked Suspect. NaN and
+// infinities are rejected in both modes since they cannot be stored
+func (v *Validator) Apply(ev *SourceEvent) {
+	if ev.Err != nil {
+		return
+	}
+	err := checkFinite(ev.Packet)
+	reject := err != nil
+	if err == nil {
+		err = v.Check(ev.Packet)
+	}
+	if err == nil {
+		return
+	}
+
+	ev.fillRaw()
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Line = ev.Raw
+		pe.Offset = -1
+		if !ev.Binary {
+			pe.Offset = fieldOffset(ev.Raw, pe.Field)
+		}
+	}
+	if reject || v.Mode == ValidationStrict {
+		ev.Err = err
+		return
+	}
+	ev.Packet.Suspect = true
+}
+
+// fieldOffset finds where a field's value starts in a raw line, or -1
+func fieldOffset(line, name string) int {
+	spec, ok := fieldSchema.Spec(name)
+	if !ok {
+		return -1
+	}
+	if i := strings.Index(line, spec.Prefix); i >= 0 {
+		return i + len(spec.Prefix)
+	}
+	return -1
+}